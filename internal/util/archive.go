@@ -0,0 +1,294 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// TarGzDir writes the files in dir into w as a tar.gz archive.
+// The files are put in the topDir directory in the archive.
+func TarGzDir(w io.Writer, dir, topDir string) error {
+	gw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(gw)
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		var name = path.Join(topDir, filepath.ToSlash(rel))
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		// Make archives reproducible across users.
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// ZipDir writes the files in dir into w as a zip archive.
+// The files are put in the topDir directory in the archive.
+func ZipDir(w io.Writer, dir, topDir string) error {
+	zw := zip.NewWriter(w)
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(topDir, filepath.ToSlash(rel))
+		if d.IsDir() {
+			hdr.Name += "/"
+		} else {
+			hdr.Method = zip.Deflate
+		}
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+
+		switch mode := info.Mode(); {
+		case mode&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(fw, link)
+			return err
+		case !mode.IsRegular():
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(fw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// safeArchivePath returns the local path of an archive entry.
+// It returns an error if the entry would be put out of dir, either
+// directly or through a symlink extracted earlier (symlinks may be
+// chained, so every parent component is checked on disk).
+func safeArchivePath(dir, name string) (string, error) {
+	var clean = path.Clean(strings.Replace(name, `\`, "/", -1))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || filepath.VolumeName(clean) != "" {
+		return "", fmt.Errorf("unsafe path in archive: %s", name)
+	}
+
+	var parent = dir
+	var elems = strings.Split(clean, "/")
+	for _, elem := range elems[:len(elems)-1] {
+		parent = filepath.Join(parent, elem)
+		info, err := os.Lstat(parent)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("unsafe path in archive: %s (under symlink %s)", name, filepath.Base(parent))
+		}
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+// safeSymlink creates a symlink which must not point to out of dir.
+func safeSymlink(dir, link, target string) error {
+	if filepath.IsAbs(target) {
+		return fmt.Errorf("unsafe symlink in archive: %s -> %s", link, target)
+	}
+	var resolved = filepath.Join(filepath.Dir(link), target)
+	if rel, err := filepath.Rel(dir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("unsafe symlink in archive: %s -> %s", link, target)
+	}
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(target, link)
+}
+
+func extractFile(r io.Reader, dst string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ExtractTarGz extracts a tar.gz archive into dir.
+// Entries which would be put out of dir are rejected.
+func ExtractTarGz(r io.Reader, dir string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		dst, err := safeArchivePath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(dst, 0755)
+		case tar.TypeReg, tar.TypeRegA:
+			err = extractFile(tr, dst, hdr.FileInfo().Mode())
+		case tar.TypeSymlink:
+			err = safeSymlink(dir, dst, hdr.Linkname)
+		default:
+			err = fmt.Errorf("unsupported entry in archive: %s", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ExtractZip extracts a zip archive into dir.
+// Entries which would be put out of dir are rejected.
+func ExtractZip(archivePath, dir string) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		dst, err := safeArchivePath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+
+		var mode = f.Mode()
+		if mode.IsDir() {
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		switch {
+		case mode&fs.ModeSymlink != 0:
+			var target []byte
+			if target, err = io.ReadAll(rc); err == nil {
+				err = safeSymlink(dir, dst, string(target))
+			}
+		case mode.IsRegular():
+			err = extractFile(rc, dst, mode)
+		default:
+			err = fmt.Errorf("unsupported entry in archive: %s", f.Name)
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+type diffLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// UnifiedDiff writes the line differences between two texts in the
+// unified format, with the specified number of context lines.
+// Nothing is written if the texts are identical.
+func UnifiedDiff(w io.Writer, fromName, toName, from, to string, context int) (changed bool, err error) {
+	var lines []diffLine
+	for _, d := range diff.Do(from, to) {
+		var kind byte = ' '
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			kind, changed = '-', true
+		case diffmatchpatch.DiffInsert:
+			kind, changed = '+', true
+		}
+		for _, text := range strings.SplitAfter(d.Text, "\n") {
+			if text != "" {
+				lines = append(lines, diffLine{kind, text})
+			}
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	// The line numbers (0-based) in the two texts before each line.
+	var fromLines, toLines = make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, line := range lines {
+		fromLines[i+1], toLines[i+1] = fromLines[i], toLines[i]
+		if line.kind != '+' {
+			fromLines[i+1]++
+		}
+		if line.kind != '-' {
+			toLines[i+1]++
+		}
+	}
+
+	if _, err = fmt.Fprintf(w, "--- %s\n+++ %s\n", fromName, toName); err != nil {
+		return
+	}
+
+	var n = len(lines)
+	for i := 0; i < n; {
+		for i < n && lines[i].kind == ' ' {
+			i++
+		}
+		if i == n {
+			break
+		}
+
+		var start, end = i - context, i
+		if start < 0 {
+			start = 0
+		}
+		for {
+			for end < n && lines[end].kind != ' ' {
+				end++
+			}
+			var next = end
+			for next < n && lines[next].kind == ' ' {
+				next++
+			}
+			if next < n && next-end <= 2*context {
+				end = next
+				continue
+			}
+			if end += context; end > n {
+				end = n
+			}
+			break
+		}
+
+		if err = writeDiffHunk(w, lines[start:end], fromLines[start], fromLines[end], toLines[start], toLines[end]); err != nil {
+			return
+		}
+		i = end
+	}
+
+	return true, nil
+}
+
+func writeDiffHunk(w io.Writer, lines []diffLine, fromStart, fromEnd, toStart, toEnd int) error {
+	var fromCount, toCount = fromEnd - fromStart, toEnd - toStart
+	if fromCount > 0 {
+		fromStart++
+	}
+	if toCount > 0 {
+		toStart++
+	}
+	if _, err := fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", fromStart, fromCount, toStart, toCount); err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		var text = line.text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n\\ No newline at end of file\n"
+		}
+		if _, err := fmt.Fprintf(w, "%c%s", line.kind, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter prefixes each line written to it, so that
+// the outputs of several concurrent processes are still
+// readable when they are interleaved.
+//
+// PrefixWriters writing to the same underlying writer
+// should share the same mutex, so that lines are never
+// broken by other lines.
+type PrefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix []byte
+	buf    []byte // the current incomplete line
+}
+
+func NewPrefixWriter(w io.Writer, mu *sync.Mutex, prefix string) *PrefixWriter {
+	return &PrefixWriter{w: w, mu: mu, prefix: []byte(prefix)}
+}
+
+func (pw *PrefixWriter) Write(p []byte) (int, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	var n = len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			pw.buf = append(pw.buf, p...)
+			break
+		}
+
+		pw.buf = append(pw.buf, p[:i+1]...)
+		p = p[i+1:]
+		if err := pw.writeLine(); err != nil {
+			return n - len(p), err
+		}
+	}
+	return n, nil
+}
+
+func (pw *PrefixWriter) writeLine() error {
+	var line = make([]byte, 0, len(pw.prefix)+len(pw.buf))
+	line = append(line, pw.prefix...)
+	line = append(line, pw.buf...)
+	pw.buf = pw.buf[:0]
+	_, err := WriteAll(pw.w, line)
+	return err
+}
+
+// Flush writes the current incomplete line, if it exists.
+func (pw *PrefixWriter) Flush() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	pw.buf = append(pw.buf, '\n')
+	return pw.writeLine()
+}
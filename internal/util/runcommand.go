@@ -12,6 +12,12 @@ import (
 )
 
 func RunShellCommand(timeout time.Duration, wd string, buildEnv func() []string, stdin io.Reader, stdout, stderr io.Writer, cmd string, args ...string) ([]byte, error) {
+	return RunShellCommandContext(context.Background(), timeout, wd, buildEnv, stdin, stdout, stderr, cmd, args...)
+}
+
+// RunShellCommandContext is like RunShellCommand, but the command is
+// also killed if ctx is done.
+func RunShellCommandContext(ctx context.Context, timeout time.Duration, wd string, buildEnv func() []string, stdin io.Reader, stdout, stderr io.Writer, cmd string, args ...string) ([]byte, error) {
 	if wd == "" {
 		var err error
 		wd, err = os.Getwd()
@@ -21,7 +27,7 @@ func RunShellCommand(timeout time.Duration, wd string, buildEnv func() []string,
 			wd = ""
 		}
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	command := exec.CommandContext(ctx, cmd, args...)
 	command.Dir = wd
@@ -71,3 +77,11 @@ func RunShell(timeout time.Duration, wd string, buildEnv func() []string, stdin
 
 	return RunShellCommand(timeout, wd, buildEnv, stdin, stdout, stderr, cmdAndArgs[0], cmdAndArgs[1:]...)
 }
+
+func RunShellContext(ctx context.Context, timeout time.Duration, wd string, buildEnv func() []string, stdin io.Reader, stdout, stderr io.Writer, cmdAndArgs ...string) ([]byte, error) {
+	if len(cmdAndArgs) == 0 {
+		panic("command is not specified")
+	}
+
+	return RunShellCommandContext(ctx, timeout, wd, buildEnv, stdin, stdout, stderr, cmdAndArgs[0], cmdAndArgs[1:]...)
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"math"
+	"sort"
+)
+
+// MannWhitneyUTest returns the two-sided p-value of the Mann-Whitney
+// U-test for the two samples, which tells whether or not the samples
+// are from the same distribution. The p-value is computed exactly
+// for small samples without ties, otherwise, it is approximated
+// with the normal distribution.
+func MannWhitneyUTest(x, y []float64) float64 {
+	var n1, n2 = len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	type value struct {
+		v       float64
+		inFirst bool
+	}
+	var values = make([]value, 0, n1+n2)
+	for _, v := range x {
+		values = append(values, value{v, true})
+	}
+	for _, v := range y {
+		values = append(values, value{v, false})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].v < values[j].v })
+
+	// Tied values get the average of their ranks.
+	var rankSum1, tieCorrection float64
+	var hasTies bool
+	for i := 0; i < len(values); {
+		var j = i + 1
+		for j < len(values) && values[j].v == values[i].v {
+			j++
+		}
+		var rank = float64(i+j+1) / 2 // ranks are 1-based
+		for k := i; k < j; k++ {
+			if values[k].inFirst {
+				rankSum1 += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			hasTies = true
+			tieCorrection += t*t*t - t
+		}
+		i = j
+	}
+	var u = rankSum1 - float64(n1*(n1+1))/2
+
+	if !hasTies && n1+n2 <= 50 {
+		var counts = uDistribution(n1, n2)
+		var total, below, above float64
+		for k, c := range counts {
+			total += c
+			if float64(k) <= u {
+				below += c
+			}
+			if float64(k) >= u {
+				above += c
+			}
+		}
+		return math.Min(1, 2*math.Min(below, above)/total)
+	}
+
+	var n = float64(n1 + n2)
+	var mean = float64(n1*n2) / 2
+	var variance = float64(n1*n2) / 12 * (n + 1 - tieCorrection/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	var z = math.Abs(u-mean) - 0.5 // continuity correction
+	if z < 0 {
+		z = 0
+	}
+	return math.Min(1, math.Erfc(z/math.Sqrt(2*variance)))
+}
+
+// uDistribution returns the numbers of the arrangements of n1 and n2
+// items, indexed by U statistics.
+func uDistribution(n1, n2 int) []float64 {
+	// counts[i][j] is the distribution for i and j items.
+	var counts = make([][][]float64, n1+1)
+	for i := range counts {
+		counts[i] = make([][]float64, n2+1)
+		for j := range counts[i] {
+			var c = make([]float64, i*j+1)
+			switch {
+			case i == 0 || j == 0:
+				c[0] = 1
+			default:
+				// The largest item is either from the first sample,
+				// which is larger than all the j items of the second
+				// sample, or from the second sample.
+				for u, v := range counts[i-1][j] {
+					c[u+j] += v
+				}
+				for u, v := range counts[i][j-1] {
+					c[u] += v
+				}
+			}
+			counts[i][j] = c
+		}
+	}
+	return counts[n1][n2]
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"time"
 
 	"go101.org/gotv/internal/util"
+	"go101.org/gotv/toolchain"
 )
 
 func _(x []int) *[1]int {
@@ -21,6 +23,14 @@ func main() {
 	copy(args, os.Args)
 
 	program := args[0]
+
+	// The -offline option is only recognized before other arguments.
+	var offline = os.Getenv("GOTV_OFFLINE") == "1"
+	for len(args) > 1 && args[1] == "-offline" {
+		offline = true
+		args = append(args[:1], args[2:]...)
+	}
+
 	if len(args) < 2 || args[1] == "-h" || args[1] == "--help" {
 		printUsage(program)
 		return
@@ -31,49 +41,23 @@ func main() {
 		return
 	}
 
-	gotv, err := born()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	var opts = toolchain.Options{Offline: offline, Stdin: os.Stdin}
+	if os.Getenv("GOTV_PROGRESS") == "json" {
+		opts.Reporter = toolchain.NewJSONReporter(os.Stderr)
 	}
 
-	args = args[1:]
-
-	err = gotv.tryRunningSpecialCommand(args)
-	switch err {
-	case nil:
-		return
-	default:
+	gotv, err := toolchain.New(opts)
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
-	case unknownCommand{}:
-		break
 	}
 
-	if tv := parseGoToolchainVersion(args[0], false); tv.kind == kind_Default {
-		tv = gotv.DefaultVersion()
-		if invalid, _ := tv.IsInvalid(); invalid {
-			//fmt.Print(".\n\n")
-			//printSetDefaultVersion(program)
-			//os.Exit(1)
-			fmt.Print("No toolchain version is provided, try to use the latest release version.\n\n")
-			tv = parseGoToolchainVersion(".", true)
-		} else {
-			fmt.Printf("No toolchain version is provided, try to use default version (%v).\n\n", tv)
-		}
-
-		if err := gotv.tryRunningGoToolchainCommand(tv, args); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
+	if err := gotv.RunCommand(args[1:]); err != nil {
+		if ee, ok := err.(*exec.ExitError); ok { // the go command fails
+			os.Exit(ee.ExitCode())
 		}
-	} else if invalid, message := tv.IsInvalid(); invalid {
-		fmt.Fprintln(os.Stderr, message)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
-	} else {
-		if err := gotv.tryRunningGoToolchainCommand(tv, args[1:]); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
 	}
 }
 
@@ -92,7 +76,26 @@ const descToolchainVersion = `where ToolchainVersion might be
 	  branch in the Go git repository.
 	* :N.M, such as :1.17, :1.18 and :1.19, which mean
 	  the local latest release-branch.goN.M branch
-	  in the Go git repository.`
+	  in the Go git repository.
+	* bra:REMOTE/BRANCH, which means a branch in
+	  a remote added by the add-remote command.
+	* src:DIR, such as src:~/go-dev, which means
+	  the Go source tree in a local directory.
+	  The toolchain is cached by the content of
+	  the tree, uncommitted changes included.
+
+	A ToolchainVersion might be suffixed with build
+	options, such as 1.21+cgo, 1.21+exp=rangefunc,
+	and 1.21+cgo+goamd64=v3, which mean building the
+	toolchain with CGO_ENABLED=1, GOEXPERIMENT=rangefunc,
+	and CGO_ENABLED=1 GOAMD64=v3, respectively.
+	(By default, toolchains are built with CGO_ENABLED=0.)
+	A +target=GOOS/GOARCH suffix means cross-compiling
+	the toolchain for another platform.
+	A +patch=PATH suffix means applying a patch file,
+	or the .patch and .diff files in a directory (in
+	name order), to the source before building.
+	Differently configured toolchains are cached separately.`
 
 func printSetDefaultVersion(program string) {
 	fmt.Fprintf(os.Stderr, `It looks you want to use the default toolchain version,
@@ -112,28 +115,151 @@ func printUsage(program string) {
 	fmt.Printf(`GoTV %s
 
 Usage (to use a specific Go toolchain version):
-	%s ToolchainVersion [go-arguments...]
+	%s ToolchainVersion [-env:NAME=VALUE ...] [-gocache:POLICY] [-gomodcache:POLICY] [go-arguments...]
 
 	%s
 
 	A ToolchainVersion suffixed with ! means remote
 	versions are needed to be fetched firstly.
 
+	The -env:NAME=VALUE options set environment variables
+	for the go command. They take effect after the default
+	envs set for the version (see the default-envs command).
+
+	The -gocache:POLICY and -gomodcache:POLICY options
+	specify which GOCACHE and GOMODCACHE are used:
+	* shared, the ones of the user (the default).
+	* gotv, the ones shared by all gotv toolchains.
+	* isolated, the ones owned by the toolchain.
+	The default policies are set by default-caches.
+
 GoTV specific commands:
+	gotv init-repo [-strategy=STRATEGY] [-depth=N] [URL]
+		clone the Go git repository with a strategy:
+		* full, all branches and tags (the default).
+		* release-tags, only the release tags.
+		* single-branch, only the master branch.
+		* blobless, all commits but no file contents
+		  (needs the git command).
+		Missing tags, branches and revisions are fetched
+		on demand for partial clones.
 	gotv fetch-versions
 		fetch remote versions (sync git repository)
+	gotv fetch-interval [Duration]
+		show or set the interval (such as 24h, 0 to disable)
+		of fetching remote versions automatically before
+		resolving pseudo-versions (such as 1.22.) and aliases
+		(such as :tip)
+	gotv fetch-refspecs [RefSpec ... | -default]
+		show or set the refspecs used to fetch origin, such as
+		refs/tags/go* and release-branch.* (branch patterns),
+		-default restores the ones in the remote config.
+		References deleted in remotes are pruned when fetching.
+	gotv mirrors [-timeout=Duration] [URL ... | -clear]
+		show or set the mirrors of the Go git repository, which
+		are tried in order (each is probed within the timeout,
+		30s by default) when cloning and fetching fail with the
+		origin address. Cloning and fetching also fail if they
+		make no progress within the timeout.
+	gotv verify-tags [off | signature -keyring=File | pinned]
+		show or set how tags are verified before building
+		toolchains from them (the result is recorded in the
+		gotv.info file of each toolchain):
+		* signature, tags must be annotated tags signed by the
+		  keys in the keyring (an armored public key file).
+		* pinned, tags must point to the pinned official
+		  release commits.
+	gotv record-release-commits
+		pin the commits of the release tags in the local Go git
+		repository, whose origin must be an official address
+		(https://go.googlesource.com/go or
+		https://github.com/golang/go), the pinned ones are
+		unchanged
+	gotv doctor
+		check the Go git repository, the cached toolchains,
+		the bootstrap toolchain and the PATH setup, and show
+		how to fix the found problems
 	gotv list-versions
 		list all (local) releases and versions branches
-	gotv cache-version ToolchainVersion [ToolchainVersion ...]
+	gotv cache-version [options] ToolchainVersion [ToolchainVersion ...]
 		cache one or more versions
-	gotv uncache-version ToolchainVersion [ToolchainVersion ...]
+		-target: cross-compile the toolchains for GOOS/GOARCH
+		-archive: also package the toolchains as .tar.gz
+		          files in the current directory
+		-verify: run the Go test suite (run.bash) after
+		         building, failed toolchains are not kept
+		-verify-run=regexp: only run the selected tests
+		         (go tool dist test -run regexp)
+		-j=N: build at most N versions concurrently
+		-k: keep going on errors and report a summary
+	gotv export-version [-o archive-file] ToolchainVersion
+		package a cached version as a .tar.gz or .zip file
+	gotv import-version [-force] archive-file
+		cache a version from an exported archive file
+	gotv diff [-U=N] ToolchainVersion ToolchainVersion [-env:NAME=VALUE ...] -- go-arguments...
+		run a go command with two versions and show the
+		differences between the outputs (in unified format,
+		with N context lines, GOROOT and $HOME normalized)
+	gotv bench [-n=N] [-alpha=A] ToolchainVersion ToolchainVersion [-env:NAME=VALUE ...] -- go-test-arguments...
+		run go test benchmarks with two versions N (default 5)
+		times and compare the results, deltas with p-values of
+		the Mann-Whitney U-test >= A (default 0.05) are shown as ~
+	gotv build-log ToolchainVersion
+		show the log of the last build of a version
+	gotv uncache-version [-k] ToolchainVersion [ToolchainVersion ...]
 		uncache one or more versions
+		-k: keep going on errors and report a summary
 	gotv pin-version ToolchainVersion
 		pin a specified version
 	gotv unpin-version
 		unpin the current pinned version
 	gotv default-version ToolchainVersion
 		set the default version
+	gotv default-envs [ToolchainVersion [NAME=VALUE ... | -clear]]
+		show or set the default envs for a version
+	gotv default-caches [-gocache=POLICY] [-gomodcache=POLICY]
+		show or set the default GOCACHE and GOMODCACHE policies
+	gotv clean-caches [ToolchainVersion ...]
+		remove the GOCACHE and GOMODCACHE directories
+		in the gotv cache dir (all, or the isolated ones
+		of the specified versions)
+	gotv list-remotes
+		list the remotes of the Go git repository
+	gotv add-remote Name URL
+		add (and fetch) a remote, such as a Go fork
+	gotv remove-remote Name
+		remove a remote and its branches
+
+Options (before other arguments):
+	-offline
+		never access the network (the same as GOTV_OFFLINE=1)
+
+Environment variables:
+	GOTV_OFFLINE=1
+		never access the network. Versions are resolved from
+		the local Go git repository, or from the cached
+		toolchains if the repository doesn't exist. Fetching
+		remote versions (including the ! suffix) and cloning
+		the repository fail with errors instead.
+	GOTV_PROGRESS=json
+		report the progress of syncing the Go git repository
+		and building toolchains as JSON lines to stderr
+		(for CI logs), instead of printing it for humans
+	GOTV_GIT_USERNAME, GOTV_GIT_PASSWORD, GOTV_GIT_TOKEN
+		the credentials of HTTPS repositories (basic auth, or
+		bearer token auth). They are only sent to the host of
+		GOTV_GIT_HOST, or to the host of the origin remote if it
+		is unset. Otherwise, the credentials are looked up in
+		the netrc file ($NETRC or ~/.netrc), then from the git
+		credential helpers if the server requires them.
+	HTTP_PROXY, HTTPS_PROXY, NO_PROXY
+		the proxies used to access HTTP(S) repositories
+	GOTV_GIT_CA_BUNDLE (or GIT_SSL_CAINFO)
+		a PEM file of the extra CA certificates trusted
+		when accessing HTTPS repositories (the proxies
+		are not used together with it)
+	Blobless clones are fetched by the git command, which
+	uses its own credential, proxy and CA settings.
 `,
 		Version,
 		filepath.Base(program),
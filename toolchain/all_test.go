@@ -0,0 +1,1304 @@
+package toolchain
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	gitclient "github.com/go-git/go-git/v5/plumbing/transport/client"
+	"go101.org/gotv/internal/util"
+)
+
+var gotvForTesting GoTV
+
+func init() {
+	cacheDir, err := os.MkdirTemp("", "gotv-cache-*")
+	if err != nil {
+		panic(err)
+	}
+
+	configDir, err := os.MkdirTemp("", "gotv-config-*")
+	if err != nil {
+		panic(err)
+	}
+
+	gotvForTesting, err = bornWithCacheAndConfigDir(cacheDir, configDir)
+	if err != nil {
+		panic(err)
+	}
+
+	rand.Seed(time.Now().UnixNano())
+}
+
+func Test_sortVersions(t *testing.T) {
+	var sorted = []string{
+		"1",
+		"1.1",
+		"1.1.1",
+		"1.5",
+		"1.10",
+		"1.11beta1",
+		"1.11beta2",
+		"1.11rc1",
+		"1.11.2",
+		"1.11.11",
+	}
+
+	for range [100]struct{}{} {
+		var vs = append([]string{}, sorted...)
+		for range [32]struct{}{} {
+			var i, j = rand.Intn(len(vs)), rand.Intn(len(vs))
+			vs[i], vs[j] = vs[j], vs[i]
+		}
+		//t.Log(vs)
+		var vs2 = append([]string{}, vs...)
+		sortVersions(vs2)
+		for i := range sorted {
+			if vs2[i] != sorted[i] {
+				t.Errorf("wrong sorting result:\n  for %v\n  get %v\n", vs, vs2)
+			}
+		}
+	}
+}
+
+func Test_parseGoToolchainVersion(t *testing.T) {
+	var cases = []struct {
+		v  string
+		tv toolchainVersion
+	}{
+		{"1.21.0", toolchainVersion{kind_Release, "1.21.0", false, buildOptions{}}},
+		{"1.19.0", toolchainVersion{kind_Release, "1.19", false, buildOptions{}}},
+		{"1.19", toolchainVersion{kind_Release, "1.19", false, buildOptions{}}},
+		{"1.19!", toolchainVersion{kind_Release, "1.19", true, buildOptions{}}},
+		{":1.19", toolchainVersion{kind_Alias, "1.19", false, buildOptions{}}},
+		{":1.19!", toolchainVersion{kind_Alias, "1.19", true, buildOptions{}}},
+		{":tip", toolchainVersion{kind_Alias, "tip", false, buildOptions{}}},
+		{":tip!", toolchainVersion{kind_Alias, "tip", true, buildOptions{}}},
+		{"bra:1.19", toolchainVersion{kind_Branch, "1.19", false, buildOptions{}}},
+		{"tag:1.19", toolchainVersion{kind_Tag, "1.19", false, buildOptions{}}},
+		{"rev:12ab", toolchainVersion{kind_Revision, "12ab", false, buildOptions{}}},
+		{"1.21+cgo", toolchainVersion{kind_Release, "1.21", false, buildOptions{cgo: true}}},
+		{"1.19.0+goamd64=v3!", toolchainVersion{kind_Release, "1.19", true, buildOptions{goamd64: "v3"}}},
+		{":tip+exp=rangefunc+cgo", toolchainVersion{kind_Alias, "tip", false, buildOptions{cgo: true, experiment: "rangefunc"}}},
+		{"1.22+exp=loopvar,arenas+exp=loopvar", toolchainVersion{kind_Release, "1.22", false, buildOptions{experiment: "arenas,loopvar"}}},
+		{"src:/go-dev+cgo", toolchainVersion{kind_Source, "/go-dev", false, buildOptions{cgo: true}}},
+		{"src:/go-dev@0123456789abcdef!", toolchainVersion{kind_Source, "/go-dev@0123456789abcdef", true, buildOptions{}}},
+	}
+
+	for _, c := range cases {
+		if r := parseGoToolchainVersion(c.v, true); r != c.tv {
+			t.Errorf(`parseGoToolchainVersion("%s", true) != %v, but %v`, c.v, c.tv, r)
+		}
+	}
+}
+
+func Test_parseGoToolchainVersion_BuildOptions(t *testing.T) {
+	for _, v := range []string{"1.21+", "+cgo", "1.21+cgo=1", "1.21+goamd64=v5", "1.21+exp=a-b", "1.21+foo", "build+cgo"} {
+		if tv := parseGoToolchainVersion(v, false); tv.kind != kind_Invalid {
+			t.Errorf(`parseGoToolchainVersion("%s", false) should be invalid, but %v`, v, tv)
+		}
+	}
+
+	var tv = parseGoToolchainVersion("tag:go1.21.5+goamd64=v3+cgo+exp=rangefunc", true)
+	if s := tv.String(); s != "tag:go1.21.5+cgo+exp=rangefunc+goamd64=v3" {
+		t.Errorf("wrong version string: %s", s)
+	}
+	if f := tv.folderName(); f != "tag_go1.21.5+cgo+exp=rangefunc+goamd64=v3" {
+		t.Errorf("wrong folder name: %s", f)
+	}
+	if tv2 := parseGoToolchainVersion(tv.String(), true); tv2 != tv {
+		t.Errorf("version string is not parsed back: %v vs. %v", tv2, tv)
+	}
+}
+
+func Test_resolvePatches(t *testing.T) {
+	var dir = t.TempDir()
+	for name, content := range map[string]string{"2.diff": "b", "1.patch": "a", "x.txt": "x"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tv = parseGoToolchainVersion("tag:go1.21.5+patch="+dir, true)
+	if tv.kind != kind_Tag || tv.options.patch != dir {
+		t.Fatalf("bad parsed version: %v", tv)
+	}
+	files, err := tv.options.patchFiles()
+	if err != nil {
+		t.Fatalf("patchFiles error: %s", err)
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != "1.patch" || filepath.Base(files[1]) != "2.diff" {
+		t.Errorf("wrong patch files: %v", files)
+	}
+
+	if err := tv.options.resolvePatches(); err != nil {
+		t.Fatalf("resolvePatches error: %s", err)
+	}
+	var folder = tv.folderName()
+	if folder != "tag_go1.21.5+patch="+tv.options.patchHash || strings.Contains(folder, dir) {
+		t.Errorf("wrong folder name: %s", folder)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "1.patch"), []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var tv2 = parseGoToolchainVersion("tag:go1.21.5+patch="+dir, true)
+	if err := tv2.options.resolvePatches(); err != nil {
+		t.Fatalf("resolvePatches error: %s", err)
+	}
+	if tv2.folderName() == folder {
+		t.Errorf("folder name is not changed with patch content")
+	}
+}
+
+func Test_folderName_Branches(t *testing.T) {
+	var folders = make(map[string]string)
+	for _, version := range []string{"bra:master", "bra:fork/x", "bra:fork_x", "bra:fork%2Fx", "bra:a/_x", "bra:a_/x"} {
+		var tv = parseGoToolchainVersion(version, true)
+		var folder = tv.folderName()
+		if strings.Contains(folder, "/") {
+			t.Errorf("the folder name of %s contains slashes: %s", version, folder)
+		}
+		if other, ok := folders[folder]; ok {
+			t.Errorf("%s and %s have the same folder name: %s", version, other, folder)
+		}
+		folders[folder] = version
+	}
+	if f := parseGoToolchainVersion("bra:fork/x", true).folderName(); f != "bra_fork%2Fx" {
+		t.Errorf("wrong folder name: %s", f)
+	}
+}
+
+func Test_splitSourceVersion(t *testing.T) {
+	var cases = []struct {
+		version, dir, hash string
+	}{
+		{"/go-dev", "/go-dev", ""},
+		{"/go-dev@0123456789abcdef", "/go-dev", "0123456789abcdef"},
+		{"/me@home/go", "/me@home/go", ""},
+		{"/go-dev@0123456789ABCDEF", "/go-dev@0123456789ABCDEF", ""},
+	}
+	for _, c := range cases {
+		if dir, hash := splitSourceVersion(c.version); dir != c.dir || hash != c.hash {
+			t.Errorf("splitSourceVersion(%q) = (%q, %q), but (%q, %q) expected", c.version, dir, hash, c.dir, c.hash)
+		}
+	}
+
+	var tv = toolchainVersion{kind_Source, "/go-dev@0123456789abcdef", false, buildOptions{}}
+	if f := tv.folderName(); f != "src_0123456789abcdef" {
+		t.Errorf("wrong folder name: %s", f)
+	}
+}
+
+func Test_UnifiedDiff(t *testing.T) {
+	var from = "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	var to = "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	var buf strings.Builder
+	changed, err := util.UnifiedDiff(&buf, "x", "y", from, to, 1)
+	if err != nil || !changed {
+		t.Fatalf("UnifiedDiff: %v, %v", changed, err)
+	}
+	var expected = "--- x\n+++ y\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -10,1 +10,2 @@\n j\n+k\n"
+	if diff := buf.String(); diff != expected {
+		t.Errorf("wrong diff:\n%s\nexpected:\n%s", diff, expected)
+	}
+
+	if changed, _ := util.UnifiedDiff(&buf, "x", "y", from, from, 3); changed {
+		t.Errorf("identical texts are reported as changed")
+	}
+}
+
+func Test_parseBenchOutput(t *testing.T) {
+	var output = `goos: linux
+pkg: example.com/a
+BenchmarkX-8   	 1000	      1234 ns/op	      16 B/op	       1 allocs/op
+BenchmarkY-8   	  500	      2000 ns/op
+PASS
+pkg: example.com/b
+BenchmarkX-8   	 1000	      1000 ns/op
+ok  	example.com/b	1.2s
+`
+	var names []string
+	var results = make(benchResults)
+	results.parseBenchOutput([]byte(output), &names)
+	results.parseBenchOutput([]byte(output), &names)
+	if len(names) != 3 || names[0] != "example.com/a.X-8" || names[2] != "example.com/b.X-8" {
+		t.Fatalf("wrong benchmark names: %v", names)
+	}
+	if v := results["example.com/a.X-8"]["B/op"]; len(v) != 2 || v[0] != 16 {
+		t.Errorf("wrong B/op results: %v", v)
+	}
+	if v := results["example.com/b.X-8"]["ns/op"]; len(v) != 2 || v[1] != 1000 {
+		t.Errorf("wrong ns/op results: %v", v)
+	}
+}
+
+func Test_MannWhitneyUTest(t *testing.T) {
+	var x, y = []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}
+	if p := util.MannWhitneyUTest(x, y); math.Abs(p-2.0/252) > 1e-9 {
+		t.Errorf("wrong p-value for separated samples: %v", p)
+	}
+	if p := util.MannWhitneyUTest(x, x); p != 1 {
+		t.Errorf("wrong p-value for identical samples: %v", p)
+	}
+	if p := util.MannWhitneyUTest([]float64{1}, []float64{2}); p != 1 {
+		t.Errorf("wrong p-value for single samples: %v", p)
+	}
+}
+
+func Test_parseGoCommandOptions(t *testing.T) {
+	opts, goArgs, err := parseGoCommandOptions([]string{"-env:CGO_ENABLED=1", "-env:GOFLAGS=-mod=mod", "build", "-env:X=1"})
+	if err != nil {
+		t.Fatalf("parseGoCommandOptions error: %s", err)
+	}
+	if len(opts.envs) != 2 || opts.envs[0] != "CGO_ENABLED=1" || opts.envs[1] != "GOFLAGS=-mod=mod" {
+		t.Errorf("wrong envs: %v", opts.envs)
+	}
+	if len(goArgs) != 2 || goArgs[0] != "build" {
+		t.Errorf("wrong go arguments: %v", goArgs)
+	}
+
+	if _, _, err := parseGoCommandOptions([]string{"-env:=1"}); err == nil {
+		t.Errorf("parseGoCommandOptions should fail for bad env settings")
+	}
+
+	opts, goArgs, err = parseGoCommandOptions([]string{"-gocache:isolated", "-gomodcache:gotv", "-env:A=1", "test"})
+	if err != nil {
+		t.Fatalf("parseGoCommandOptions error: %s", err)
+	}
+	if opts.gocache != cachePolicy_Isolated || opts.gomodcache != cachePolicy_GoTV || len(opts.envs) != 1 || len(goArgs) != 1 {
+		t.Errorf("wrong options: %v, %v", opts, goArgs)
+	}
+
+	if _, _, err := parseGoCommandOptions([]string{"-gocache:private"}); err == nil {
+		t.Errorf("parseGoCommandOptions should fail for bad cache policies")
+	}
+}
+
+func Test_gitProgressWriter(t *testing.T) {
+	var events []Event
+	var w = newGitProgressWriter(func(e Event) { events = append(events, e) }, PhaseFetch)
+	w.Write([]byte("Counting objects:  45% (9/20)\rCounting obj"))
+	w.Write([]byte("ects: 100% (20/20), done.\nTotal 20 (delta 3)"))
+	w.Flush()
+
+	if len(events) != 3 {
+		t.Fatalf("wrong number of events: %v", events)
+	}
+	if e := events[0]; e.Message != "Counting objects" || e.Current != 9 || e.Total != 20 || e.Phase != PhaseFetch {
+		t.Errorf("wrong event: %+v", e)
+	}
+	if e := events[1]; e.Current != 20 || e.Total != 20 {
+		t.Errorf("wrong event: %+v", e)
+	}
+	if e := events[2]; e.Message != "Total 20 (delta 3)" || e.Total != 0 {
+		t.Errorf("wrong event: %+v", e)
+	}
+}
+
+func Test_collectCachedRepositoryInfo(t *testing.T) {
+	var cacheDir = t.TempDir()
+	var infos = map[string]toolchainInfo{
+		"tag_go1.22.1":                   {Revision: "aaa", Version: "tag:go1.22.1"},
+		"tag_go1.21.5+cgo":               {Revision: "bbb", Version: "tag:go1.21.5+cgo"},
+		"bra_master":                     {Revision: "ccc", Version: "bra:master"},
+		"bra_release-branch.go1.22":      {Revision: "ddd", Version: "bra:release-branch.go1.22"},
+		"rev_0123456789abcdef0123456789": {Revision: "eee", Version: "rev:0123456789abcdef0123456789"},
+	}
+	for folder, info := range infos {
+		var dir = filepath.Join(cacheDir, folder)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeToolchainInfo(dir, info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(cacheDir, "tag_go1.20"), 0700); err != nil { // incomplete
+		t.Fatal(err)
+	}
+
+	repoInfo, err := collectCachedRepositoryInfo(cacheDir)
+	if err != nil {
+		t.Fatalf("collectCachedRepositoryInfo error: %s", err)
+	}
+	if len(repoInfo.allTags) != 2 || repoInfo.allTags["go1.22.1"] != "aaa" || repoInfo.releaseTags["1.21.5"] != "go1.21.5" {
+		t.Errorf("wrong tags: %v, %v", repoInfo.allTags, repoInfo.releaseTags)
+	}
+	if len(repoInfo.allBranches) != 2 || repoInfo.tipHash != "ccc" || repoInfo.versionBranches["1.22"] != "release-branch.go1.22" {
+		t.Errorf("wrong branches: %v, %v", repoInfo.allBranches, repoInfo.versionBranches)
+	}
+}
+
+func Test_releaseVersionPrefix(t *testing.T) {
+	var cases = []struct {
+		version string
+		prefix  string
+		latest  bool
+	}{
+		{"1.", "1", true},
+		{"1.21.", "1.21", true},
+		{"1.21", "1.21", true},
+		{"1.22", "1.22", true},
+		{"1.20", "1.20", false},
+		{"1.21.5", "1.21.5", false},
+	}
+	for _, c := range cases {
+		if prefix, latest := releaseVersionPrefix(c.version); prefix != c.prefix || latest != c.latest {
+			t.Errorf("releaseVersionPrefix(%q) = %q, %v", c.version, prefix, latest)
+		}
+	}
+}
+
+func Test_repositoryIndex(t *testing.T) {
+	var repoDir = t.TempDir()
+	repo, err := git.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var when = time.Date(2024, 2, 6, 0, 0, 0, 0, time.UTC)
+	var signature = &object.Signature{Name: "gotv", Email: "gotv@go101.org", When: when}
+	hash, err := worktree.Commit("go1.22.0", &git.CommitOptions{Author: signature, AllowEmptyCommits: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateTag("go1.22.0", hash, nil); err != nil {
+		t.Fatal(err)
+	}
+	var branch = plumbing.NewRemoteReferenceName("origin", "release-branch.go1.22")
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(branch, hash)); err != nil {
+		t.Fatal(err)
+	}
+
+	repoInfo, err := collectRepositoryInfo(repoDir)
+	if err != nil {
+		t.Fatalf("collectRepositoryInfo error: %s", err)
+	}
+	if repoInfo.releaseTags["1.22.0"] != "go1.22.0" || repoInfo.versionBranches["1.22"] != "release-branch.go1.22" {
+		t.Errorf("wrong repository info: %v, %v", repoInfo.releaseTags, repoInfo.versionBranches)
+	}
+	if date := repoInfo.tagDates["go1.22.0"]; !date.Equal(when) {
+		t.Errorf("wrong tag date: %v", date)
+	}
+	if index := readRepositoryIndex(repoDir); index.Tags["go1.22.0"].Hash != hash.String() {
+		t.Errorf("the index is not saved: %v", index)
+	}
+
+	if _, err := repo.CreateTag("go1.22.1", hash, nil); err != nil {
+		t.Fatal(err)
+	}
+	repoInfo, err = collectRepositoryInfo(repoDir)
+	if err != nil {
+		t.Fatalf("collectRepositoryInfo error: %s", err)
+	}
+	if repoInfo.releaseTags["1.22.1"] != "go1.22.1" {
+		t.Errorf("the stale index is not rebuilt: %v", repoInfo.releaseTags)
+	}
+}
+
+func Test_needsLatestVersions(t *testing.T) {
+	var cases = map[string]bool{
+		"1.":         true,
+		"1.22.":      true,
+		"1.22":       true,
+		":tip":       true,
+		":1.22":      true,
+		"1.22.1":     false,
+		"1.20":       false,
+		"tag:go1.22": false,
+		"bra:master": false,
+	}
+	for version, needs := range cases {
+		if tv := parseGoToolchainVersion(version, true); needsLatestVersions(tv) != needs {
+			t.Errorf("needsLatestVersions(%s) should be %v", version, needs)
+		}
+	}
+}
+
+func Test_cloneOptions(t *testing.T) {
+	var cases = []struct {
+		opts    cloneOptions
+		partial bool
+	}{
+		{cloneOptions{}, false},
+		{cloneOptions{Strategy: cloneStrategy_Full}, false},
+		{cloneOptions{Strategy: cloneStrategy_Full, Depth: 1}, true},
+		{cloneOptions{Strategy: cloneStrategy_ReleaseTags}, true},
+		{cloneOptions{Strategy: cloneStrategy_SingleBranch}, true},
+		{cloneOptions{Strategy: cloneStrategy_Blobless}, false},
+	}
+	for _, c := range cases {
+		if c.opts.isPartial() != c.partial {
+			t.Errorf("(%s).isPartial() should be %v", c.opts, c.partial)
+		}
+	}
+
+	if !isFullRevision("db68bb9d2aa5e7a7fd2a7cad1e3c0a8b29b6a4e0") {
+		t.Errorf("a 40-char hex revision should be full")
+	}
+	if isFullRevision("db68bb9") {
+		t.Errorf("a short revision should not be full")
+	}
+}
+
+func Test_checkCachedToolchains(t *testing.T) {
+	gotv, err := bornWithCacheAndConfigDir(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos = map[string]*toolchainInfo{
+		"tag_go1.22.1": {Revision: "aaa", Version: "tag:go1.22.1"}, // good
+		"tag_go1.22.0": {Revision: "bbb", Version: "tag:go1.22.1"}, // wrong folder
+		"bra_master":   {Revision: "ccc", Version: "bra:master"},   // no go command
+		"tag_go1.20":   nil,                                        // incomplete
+		"tag_go1.21.5+patch=0123456789abcdef": { // good, patched
+			Revision: "ddd", Version: "tag:go1.21.5+patch=/no/such/dir", PatchHash: "0123456789abcdef",
+		},
+		"tag_go1.21.4+patch=0123456789abcdef": { // no patch hash
+			Revision: "eee", Version: "tag:go1.21.4+patch=/no/such/dir",
+		},
+	}
+	for folder, info := range infos {
+		var dir = filepath.Join(gotv.cacheDir, folder)
+		if err := os.MkdirAll(filepath.Join(dir, "bin"), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if info == nil {
+			continue
+		}
+		if err := writeToolchainInfo(dir, *info); err != nil {
+			t.Fatal(err)
+		}
+		if folder != "bra_master" {
+			if err := os.WriteFile(filepath.Join(dir, "bin", goCommandFilename(buildOptions{})), nil, 0700); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var buf strings.Builder
+	var r = &doctorReport{w: &buf}
+	gotv.checkCachedToolchains(r)
+	if r.problems != 4 {
+		t.Errorf("4 problems should be found, but %d are found:\n%s", r.problems, buf.String())
+	}
+	for _, folder := range []string{"tag_go1.22.0", "bra_master", "tag_go1.20", "tag_go1.21.4+patch=0123456789abcdef"} {
+		if !strings.Contains(buf.String(), "[FAIL] "+folder) && !strings.Contains(buf.String(), "of "+folder) {
+			t.Errorf("the problem of %s is not reported:\n%s", folder, buf.String())
+		}
+	}
+}
+
+func Test_checkRepository_NoOrigin(t *testing.T) {
+	gotv, err := bornWithCacheAndConfigDir(t.TempDir(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotv.stdout = io.Discard
+	if _, err := git.PlainInit(gotv.repositoryDir, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var check = func(fix string) {
+		t.Helper()
+		var buf strings.Builder
+		gotv.checkRepository(&doctorReport{w: &buf})
+		if !strings.Contains(buf.String(), "Fix: git -C "+gotv.repositoryDir+" remote add origin "+fix+"\n") {
+			t.Errorf("the fix should add the origin remote with %s:\n%s", fix, buf.String())
+		}
+	}
+	check("URL")
+	if err := gotv.setMirrors("https://mirror.example.com/go"); err != nil {
+		t.Fatal(err)
+	}
+	check("https://mirror.example.com/go")
+	gotv.repositoryURL = "https://example.com/go"
+	check("https://example.com/go")
+}
+
+func Test_expandFetchRefSpec(t *testing.T) {
+	var cases = map[string]string{
+		"refs/tags/go*":    "+refs/tags/go*:refs/tags/go*",
+		"refs/heads/dev.*": "+refs/heads/dev.*:refs/remotes/origin/dev.*",
+		"release-branch.*": "+refs/heads/release-branch.*:refs/remotes/origin/release-branch.*",
+		"master":           "+refs/heads/master:refs/remotes/origin/master",
+
+		"+refs/heads/*:refs/remotes/origin/*": "+refs/heads/*:refs/remotes/origin/*",
+
+		"refs/notes/*":  "",
+		"bad:":          "",
+		":refs/heads/x": "",
+	}
+	for spec, expected := range cases {
+		expanded, err := expandFetchRefSpec(spec)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("expandFetchRefSpec(%s) should fail", spec)
+			}
+		} else if err != nil || expanded != expected {
+			t.Errorf("expandFetchRefSpec(%s) should be %s, but got %s (%v)", spec, expected, expanded, err)
+		}
+	}
+}
+
+func Test_gitFetch_Prune(t *testing.T) {
+	var srcDir = t.TempDir()
+	src, err := git.PlainInit(srcDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := src.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signature = &object.Signature{Name: "gotv", Email: "gotv@go101.org", When: time.Now()}
+	hash, err := worktree.Commit("tip", &git.CommitOptions{Author: signature, AllowEmptyCommits: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var branches = []string{"dev.x", "release-branch.go1.20", "release-branch.go1.21"}
+	for _, branch := range branches {
+		var ref = plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), hash)
+		if err := src.Storer.SetReference(ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var repoDir = t.TempDir()
+	repo, err := git.PlainClone(repoDir, false, &git.CloneOptions{URL: srcDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, branch := range branches[:2] {
+		if err := src.Storer.RemoveReference(plumbing.NewBranchReferenceName(branch)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var hasBranch = func(branch string) bool {
+		_, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch), false)
+		return err == nil
+	}
+
+	// Only the references fetched by the configured refspecs are pruned.
+	var origin = originConfig{RefSpecs: []string{"+refs/heads/release-branch.*:refs/remotes/origin/release-branch.*"}}
+	pruned, err := gitFetch(context.Background(), repoDir, origin, func(Event) {}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0] != "origin/release-branch.go1.20" {
+		t.Fatalf("only origin/release-branch.go1.20 should be pruned, but got %v", pruned)
+	}
+	if !hasBranch("dev.x") || !hasBranch("release-branch.go1.21") {
+		t.Fatal("the references not pruned should be kept")
+	}
+
+	// The refspecs in the remote config are used if none are configured.
+	pruned, err = gitFetch(context.Background(), repoDir, originConfig{}, func(Event) {}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0] != "origin/dev.x" {
+		t.Fatalf("only origin/dev.x should be pruned, but got %v", pruned)
+	}
+	if !hasBranch("master") || !hasBranch("release-branch.go1.21") {
+		t.Fatal("the references not pruned should be kept")
+	}
+}
+
+func Test_parseNetrc(t *testing.T) {
+	var data = []byte(`
+machine example.com login bob password pass1
+machine go.googlesource.com
+	login alice
+	password secret
+default login anonymous password guest
+`)
+	var cases = []struct {
+		host, login, password string
+	}{
+		{"go.googlesource.com", "alice", "secret"},
+		{"example.com", "bob", "pass1"},
+		{"github.com", "anonymous", "guest"},
+	}
+	for _, c := range cases {
+		login, password, ok := parseNetrc(data, c.host)
+		if !ok || login != c.login || password != c.password {
+			t.Errorf("credentials of %s should be %s:%s, but got %s:%s (%v)", c.host, c.login, c.password, login, password, ok)
+		}
+	}
+
+	if _, _, ok := parseNetrc([]byte("machine example.com login bob password pass1"), "github.com"); ok {
+		t.Errorf("no credentials should be found for github.com")
+	}
+}
+
+func Test_gitHTTPAuth_CredentialsHost(t *testing.T) {
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "netrc"))
+	t.Setenv("GOTV_GIT_TOKEN", "secret")
+	t.Setenv("GOTV_GIT_PASSWORD", "")
+	t.Setenv("GOTV_GIT_HOST", "")
+
+	var origin = "https://go.googlesource.com/go"
+	var cases = []struct {
+		repoAddr, host string
+		withToken      bool
+	}{
+		{"https://go.googlesource.com/go", "", true},
+		{"https://mirror.example.com/go", "", false},
+		{"https://mirror.example.com/go", "mirror.example.com", true},
+		{"https://go.googlesource.com/go", "mirror.example.com", false},
+	}
+	for _, c := range cases {
+		t.Setenv("GOTV_GIT_HOST", c.host)
+		auth, err := gitHTTPAuth(c.repoAddr, origin)
+		if err != nil {
+			t.Fatalf("gitHTTPAuth error: %s", err)
+		}
+		if withToken := auth != nil; withToken != c.withToken {
+			t.Errorf("GOTV_GIT_HOST=%q: the token should be sent to %s: %v, but got %v", c.host, c.repoAddr, c.withToken, withToken)
+		}
+	}
+}
+
+func Test_gitCABundle(t *testing.T) {
+	t.Setenv("GOTV_GIT_CA_BUNDLE", "")
+	t.Setenv("GIT_SSL_CAINFO", "")
+	if data, err := gitCABundle(); data != nil || err != nil {
+		t.Errorf("no CA bundle should be used (%v, %v)", data, err)
+	}
+
+	var bundle = filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIT_SSL_CAINFO", bundle)
+	if _, err := gitCABundle(); err == nil {
+		t.Error("a CA bundle without certificates should be rejected")
+	}
+
+	// The HTTP(S) transports of go-git are not replaced.
+	var https = gitclient.Protocols["https"]
+	if _, err := gitHTTPAuth("https://go.googlesource.com/go", ""); err != nil {
+		t.Fatalf("gitHTTPAuth error: %s", err)
+	}
+	if gitclient.Protocols["https"] != https {
+		t.Error("the HTTPS transport of go-git should not be changed")
+	}
+}
+
+func Test_gitAuth_UserInput(t *testing.T) {
+	var home = t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	var addr = "git@github.com:golang/go.git"
+	if _, err := gitAuth(addr, addr, nil); !errors.Is(err, errNoUserInput) {
+		t.Errorf("asking for the ssh key file should fail without user input, but got %v", err)
+	}
+
+	var out bytes.Buffer
+	var input = &userInput{in: strings.NewReader("\n" + filepath.Join(home, "absent") + "\n"), out: &out}
+	if _, err := gitAuth(addr, addr, input); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the specified ssh key file should be read, but got %v", err)
+	}
+	if !strings.Contains(out.String(), "Specify the key file here: ") {
+		t.Errorf("the prompt should be written to the output: %q", out.String())
+	}
+}
+
+func Test_tryRepositoryURLs_IdleTimeout(t *testing.T) {
+	var messages []string
+	var report = func(e Event) {
+		if e.Kind == EventMessage {
+			messages = append(messages, e.Message)
+		}
+	}
+	var url = filepath.Join(t.TempDir(), "go")
+
+	// f makes progress for longer than the timeout.
+	used, _, err := tryRepositoryURLs(context.Background(), []string{url}, url, 100*time.Millisecond, "", report, nil, func(ctx context.Context, _ string, _ gittransport.AuthMethod, report func(Event)) error {
+		for i := 0; i < 6; i++ {
+			time.Sleep(40 * time.Millisecond)
+			report(Event{Kind: EventProgress, Time: time.Now()})
+		}
+		return ctx.Err()
+	})
+	if err != nil || used != url {
+		t.Errorf("f making progress should not time out (%s, %v)", used, err)
+	}
+	if len(messages) != 1 || !strings.Contains(messages[0], url) {
+		t.Errorf("the used URL should be reported: %v", messages)
+	}
+
+	// f is stalled.
+	_, _, err = tryRepositoryURLs(context.Background(), []string{url}, url, 100*time.Millisecond, "", report, nil, func(ctx context.Context, _ string, _ gittransport.AuthMethod, _ func(Event)) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	})
+	if err == nil || !strings.Contains(err.Error(), "no progress within") {
+		t.Errorf("stalled f should time out, but got %v", err)
+	}
+}
+
+func Test_repositoryURLs(t *testing.T) {
+	var urls = repositoryURLs("https://go.googlesource.com/go", []string{
+		"https://github.com/golang/go.git",
+		"https://go.googlesource.com/go",
+		"",
+	})
+	if strings.Join(urls, " ") != "https://go.googlesource.com/go https://github.com/golang/go.git" {
+		t.Errorf("wrong repository URLs: %v", urls)
+	}
+	if urls = repositoryURLs("", nil); len(urls) != 0 {
+		t.Errorf("no repository URLs should be returned, but got %v", urls)
+	}
+
+	var messages []string
+	var report = func(e Event) {
+		if e.Kind == EventMessage {
+			messages = append(messages, e.Message)
+		}
+	}
+	var dir = t.TempDir()
+	var called int
+	_, _, err := tryRepositoryURLs(context.Background(), []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}, "", time.Second, "", report, nil, func(context.Context, string, gittransport.AuthMethod, func(Event)) error {
+		called++
+		return nil
+	})
+	if err == nil || called != 0 || len(messages) != 2 {
+		t.Errorf("unreachable URLs should fail without calling f (%v, %d, %v)", err, called, messages)
+	}
+}
+
+func Test_parseReleaseCommits(t *testing.T) {
+	var commits = make(map[string]string)
+	var data = `
+# comment
+go1.22.0 0123456789abcdef0123456789abcdef01234567
+
+go1.22.1  89abcdef0123456789abcdef0123456789abcdef
+`
+	if err := parseReleaseCommits(strings.NewReader(data), commits); err != nil {
+		t.Fatalf("parseReleaseCommits error: %s", err)
+	}
+	if len(commits) != 2 || commits["go1.22.1"] != "89abcdef0123456789abcdef0123456789abcdef" {
+		t.Errorf("wrong release commits: %v", commits)
+	}
+
+	for _, bad := range []string{"go1.22.0", "go1.22.0 0123456", "go1.22.0 a b"} {
+		if err := parseReleaseCommits(strings.NewReader(bad), commits); err == nil {
+			t.Errorf("parsing %q should fail", bad)
+		}
+	}
+}
+
+func Test_validateExtractedToolchain(t *testing.T) {
+	var cases = []struct {
+		info  toolchainInfo
+		valid bool
+	}{
+		{toolchainInfo{Revision: "aaa", Version: "tag:go1.21.5"}, true},
+		{toolchainInfo{Revision: "aaa", Version: "tag:go1.21.5+patch=/tmp/p", PatchHash: "0123456789abcdef"}, true},
+		{toolchainInfo{Revision: "aaa", Version: "tag:../../x"}, false},
+		{toolchainInfo{Revision: "aaa", Version: "tag:go1.21.5+patch=/tmp/p", PatchHash: "/../../../x"}, false},
+		{toolchainInfo{Revision: "aaa", Version: "tag:go1.21.5+patch=/tmp/p", PatchHash: "0123456789ABCDEF"}, false},
+		{toolchainInfo{Revision: "aaa", Version: "src:/tmp/go"}, false},
+	}
+	for i, c := range cases {
+		var dir = t.TempDir()
+		var toolchainDir = filepath.Join(dir, "go")
+		for _, sub := range []string{"bin", filepath.Join("src", "runtime")} {
+			if err := os.MkdirAll(filepath.Join(toolchainDir, sub), 0700); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(toolchainDir, "bin", goCommandFilename(buildOptions{})), nil, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeToolchainInfo(toolchainDir, c.info); err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err := validateExtractedToolchain(dir)
+		if c.valid && err != nil {
+			t.Errorf("case %d (%s): should be valid, but got error: %s", i, c.info.Version, err)
+		} else if !c.valid && err == nil {
+			t.Errorf("case %d (%s): should be invalid", i, c.info.Version)
+		}
+	}
+}
+
+func Test_ExtractTarGz_ChainedSymlinks(t *testing.T) {
+	var buf bytes.Buffer
+	var gw = gzip.NewWriter(&buf)
+	var tw = tar.NewWriter(gw)
+	for _, hdr := range []*tar.Header{
+		{Name: "go/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "go/y", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "go/z", Typeflag: tar.TypeSymlink, Linkname: "y/.."},
+		{Name: "go/z/file", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			tw.Write([]byte("evil"))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var root = t.TempDir()
+	var dir = filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := util.ExtractTarGz(&buf, dir); err == nil {
+		t.Errorf("an archive writing through chained symlinks should be rejected")
+	}
+	if _, err := os.Stat(filepath.Join(root, "file")); err == nil {
+		t.Errorf("a file is written out of the extraction dir")
+	}
+}
+
+func Test_toolchainInfo_builtFrom(t *testing.T) {
+	var tv = parseGoToolchainVersion("tag:go1.22.1", true)
+	var info = toolchainInfo{Revision: "aaa", Version: tv.String(), BuildOptions: tv.options.String()}
+	if !info.builtFrom(tv, "aaa") {
+		t.Errorf("%v should be built from %s", info, tv)
+	}
+	if info.builtFrom(tv, "bbb") {
+		t.Errorf("%v should not be built from revision bbb", info)
+	}
+	if legacy := (toolchainInfo{Revision: "aaa"}); !legacy.builtFrom(tv, "aaa") {
+		t.Errorf("%v should be built from %s", legacy, tv)
+	}
+
+	// The pinned toolchain folder is shared by all versions.
+	for _, other := range []string{"tag:go1.22.1+cgo", "bra:release-branch.go1.22", "tag:go1.22.1+target=linux/arm64"} {
+		if info.builtFrom(parseGoToolchainVersion(other, true), "aaa") {
+			t.Errorf("%v should not be built from %s", info, other)
+		}
+	}
+}
+
+// newPartialClone makes a Go-like repository with the go1.21.0 and
+// go1.21.1 tags and a newer master commit, then clones its master
+// branch with the single-branch strategy into the repository dir of
+// a new GoTV value. The hash of the go1.21.0 commit is also returned.
+func newPartialClone(t *testing.T, depth int) (*GoTV, string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("the git command is needed to fetch local repositories")
+	}
+
+	var srcDir = t.TempDir()
+	repo, err := git.PlainInit(srcDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []plumbing.Hash
+	for i, message := range []string{"go1.21.0", "go1.21.1", "tip"} {
+		var when = time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC)
+		var signature = &object.Signature{Name: "gotv", Email: "gotv@go101.org", When: when}
+		hash, err := worktree.Commit(message, &git.CommitOptions{Author: signature, AllowEmptyCommits: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+		if message != "tip" {
+			if _, err := repo.CreateTag(message, hash, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	gotv, err := bornWithCacheAndConfigDir(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotv.stdout = io.Discard
+	gotv.reporter = NewTerminalReporter(io.Discard)
+	var opts = cloneOptions{Strategy: cloneStrategy_SingleBranch, Depth: depth}
+	if err := gitCloneWithOptions(context.Background(), srcDir, gotv.repositoryDir, opts, nil, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if gotv.repoInfo, err = collectRepositoryInfo(gotv.repositoryDir); err != nil {
+		t.Fatal(err)
+	}
+	return &gotv, hashes[0].String()
+}
+
+func Test_completeRepository_LatestRelease(t *testing.T) {
+	var gotv, _ = newPartialClone(t, 0)
+	if len(gotv.repoInfo.releaseTags) != 0 {
+		t.Fatalf("a single-branch clone should have no tags: %v", gotv.repoInfo.releaseTags)
+	}
+
+	var tv = parseGoToolchainVersion("1.21.", true)
+	if fetched, err := gotv.completeRepository(tv); err != nil || !fetched {
+		t.Fatalf("the release tags should be fetched (%v, %v)", fetched, err)
+	}
+	if err := gotv.normalizeToolchainVersion(&tv, false); err != nil {
+		t.Fatalf("normalizeToolchainVersion error: %s", err)
+	}
+	if tv.kind != kind_Tag || tv.version != "go1.21.1" {
+		t.Errorf("1.21. should be resolved to tag:go1.21.1, but got %s", tv)
+	}
+}
+
+func Test_completeRepository_AbbreviatedRevision(t *testing.T) {
+	var gotv, revision = newPartialClone(t, 1)
+	var abbreviated = revision[:10]
+	if gitHasCommit(gotv.repositoryDir, abbreviated) {
+		t.Fatalf("a depth-1 clone should not have revision %s", abbreviated)
+	}
+
+	var tv = parseGoToolchainVersion("rev:"+abbreviated, true)
+	if fetched, err := gotv.completeRepository(tv); err != nil || !fetched {
+		t.Fatalf("the complete history should be fetched (%v, %v)", fetched, err)
+	}
+	if !gitHasCommit(gotv.repositoryDir, abbreviated) {
+		t.Errorf("revision %s should be in the repository now", abbreviated)
+	}
+}
+
+func Test_verifyToolchain_Failure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("run.bash is used on non-Windows systems")
+	}
+	gotv, err := bornWithCacheAndConfigDir(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotv.stdout, gotv.stderr = io.Discard, io.Discard
+	gotv.verify = verifyOptions{enabled: true}
+
+	var tv = parseGoToolchainVersion("tag:go1.22.1", true)
+	var toolchainDir = filepath.Join(gotv.cacheDir, tv.folderName())
+	var script = "#!/bin/sh\necho ok runtime\necho '--- FAIL: TestGC'\necho 'FAIL runtime' >&2\nexit 1\n"
+	if err := os.MkdirAll(filepath.Join(toolchainDir, "src"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(toolchainDir, "src", "run.bash"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := gotv.createBuildLog(tv, "aaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := gotv.verifyToolchain(tv, toolchainDir, log)
+	log.finish(err)
+	if err == nil || info == nil || info.Passed {
+		t.Fatalf("the verification should fail (%v, %v)", info, err)
+	}
+
+	data, err := os.ReadFile(gotv.buildLogPath(tv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`Verification record: {"command":"./run.bash --no-rebuild","passed":false`, "Failed checks:", "--- FAIL: TestGC", "FAIL runtime"} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("the build log should contain %q:\n%s", s, data)
+		}
+	}
+}
+
+func Test_verifyCachedToolchain_Failure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("run.bash is used on non-Windows systems")
+	}
+	gotv, err := bornWithCacheAndConfigDir(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotv.stdout, gotv.stderr = io.Discard, io.Discard
+	gotv.verify = verifyOptions{enabled: true}
+
+	var tv = parseGoToolchainVersion("tag:go1.22.1", true)
+	var toolchainDir = filepath.Join(gotv.cacheDir, tv.folderName())
+	if err := os.MkdirAll(filepath.Join(toolchainDir, "src"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(toolchainDir, "src", "run.bash"), []byte("#!/bin/sh\nexit 1\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	var info = toolchainInfo{Revision: "aaa", Version: tv.String()}
+	if err := writeToolchainInfo(toolchainDir, info); err != nil {
+		t.Fatal(err)
+	}
+	log, err := gotv.createBuildLog(tv, "aaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.finish(nil)
+
+	if err := gotv.verifyCachedToolchain(tv, toolchainDir, info); err == nil {
+		t.Fatal("the verification should fail")
+	}
+	info, err = readToolchainInfo(toolchainDir)
+	if err != nil {
+		t.Fatalf("the cached toolchain should be kept: %s", err)
+	}
+	if info.Verification == nil || info.Verification.Passed {
+		t.Fatalf("the failed verification should be recorded: %+v", info.Verification)
+	}
+	if !info.Verification.failed(gotv.verify) || info.Verification.matches(gotv.verify) {
+		t.Errorf("the toolchain should not be treated as verified: %+v", info.Verification)
+	}
+}
+
+func Test_cacheVersion_VerifyCrossCompiled(t *testing.T) {
+	gotv, err := bornWithCacheAndConfigDir(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotv.stdout, gotv.stderr = io.Discard, io.Discard
+
+	for _, args := range [][]string{
+		{"-verify", "-target=plan9/386", "1.22.1"},
+		{"-verify-run=^go_test:runtime$", "1.22.1+target=plan9/386"},
+	} {
+		err := gotv.cacheVersion(args...)
+		if err == nil || !strings.Contains(err.Error(), "can't be verified") {
+			t.Errorf("cache-version %s should be rejected, but got %v", strings.Join(args, " "), err)
+		}
+	}
+	if gotv.repositoryExists() {
+		t.Error("the repository should not be cloned")
+	}
+}
+
+func Test_recordReleaseCommits_OfficialOrigin(t *testing.T) {
+	for url, official := range map[string]bool{
+		"https://go.googlesource.com/go":   true,
+		"https://go.googlesource.com/go/":  true,
+		"https://github.com/golang/go":     true,
+		"https://github.com/golang/go.git": true,
+		"https://github.com/golang/go2":    false,
+		"http://go.googlesource.com/go":    false,
+		"git@github.com:golang/go.git":     false,
+	} {
+		if isOfficialRepositoryURL(url) != official {
+			t.Errorf("%s should be official: %v", url, official)
+		}
+	}
+
+	var gotv, _ = newPartialClone(t, 1)
+	gotv.configDir = t.TempDir()
+	if err := gotv.recordReleaseCommits(); err == nil || !strings.Contains(err.Error(), "only recorded from") {
+		t.Errorf("release commits should not be recorded from a local repository, but got %v", err)
+	}
+	if _, err := os.Stat(gotv.releaseCommitsPath()); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("no release commits should be recorded (%v)", err)
+	}
+}
+
+func Test_pinVersion_CrossCompiled(t *testing.T) {
+	gotv, err := bornWithCacheAndConfigDir(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotv.stdout, gotv.stderr = io.Discard, io.Discard
+
+	if err := gotv.pinVersion("1.22.1+target=plan9/386"); err == nil || !strings.Contains(err.Error(), "can't be pinned") {
+		t.Errorf("a cross-compiled version should not be pinned, but got %v", err)
+	}
+	if _, err := os.Stat(gotv.pinnedToolchainDir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("no toolchain should be pinned (%v)", err)
+	}
+}
+
+func Test_cacheVersion_SourceWithoutRepository(t *testing.T) {
+	gotv, err := bornWithCacheAndConfigDir(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotv.stdin, gotv.stdout, gotv.stderr = nil, io.Discard, io.Discard
+
+	var srcDir = filepath.Join(t.TempDir(), "absent")
+	err = gotv.cacheVersion("src:" + srcDir)
+	if err == nil || errors.Is(err, errNoUserInput) {
+		t.Errorf("caching an absent source tree should fail without the repository, but got %v", err)
+	}
+	if gotv.repositoryExists() {
+		t.Error("the repository should not be cloned")
+	}
+}
+
+func Test_copySourceTree_GitIgnored(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("the git command is needed to list the files of source trees")
+	}
+
+	var dir = t.TempDir()
+	var files = map[string]string{
+		".gitignore":          "*.out\n/bin/\n",
+		"src/runtime/a.go":    "package runtime\n",
+		"src/runtime/b.go":    "package runtime\n",
+		"src/runtime/obj.out": "ignored\n",
+		"bin/go":              "ignored\n",
+	}
+	for name, content := range files {
+		var path = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", ".gitignore", "src/runtime/a.go"},
+		{"-c", "user.name=gotv", "-c", "user.email=gotv@go101.org", "commit", "-q", "-m", "init"},
+	} {
+		if output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s\n%s", args[0], err, output)
+		}
+	}
+
+	gotv, err := bornWithCacheAndConfigDir(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotv.stdout, gotv.stderr = io.Discard, io.Discard
+	gotv.reporter = NewTerminalReporter(io.Discard)
+	info, err := hashSourceTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var toDir = filepath.Join(t.TempDir(), "go")
+	var tv = toolchainVersion{kind: kind_Source, version: dir + "@" + info.Hash}
+	if _, err := gotv.copySourceTree(tv, toDir); err != nil {
+		t.Fatalf("copySourceTree error: %s", err)
+	}
+
+	for name, copied := range map[string]bool{
+		".gitignore":          true,
+		"src/runtime/a.go":    true,
+		"src/runtime/b.go":    true, // untracked
+		"src/runtime/obj.out": false,
+		"bin/go":              false,
+		"VERSION":             true,
+	} {
+		_, err := os.Stat(filepath.Join(toDir, filepath.FromSlash(name)))
+		if (err == nil) != copied {
+			t.Errorf("%s should be copied: %v (%v)", name, copied, err)
+		}
+	}
+}
+
+func Test_showBuildLog_Offline(t *testing.T) {
+	gotv, err := bornWithCacheAndConfigDir(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotv.stdin, gotv.stderr = nil, io.Discard
+
+	var srcDir = filepath.Join(t.TempDir(), "go-dev") // absent, so never hashed
+	for _, version := range []string{"tag:go1.22.1", "tag:go1.22.3", "tag:go1.22.1+cgo", "bra:master", "src:" + srcDir + "@0123456789abcdef"} {
+		var tv = parseGoToolchainVersion(version, true)
+		log, err := gotv.createBuildLog(tv, "aaa")
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.finish(nil)
+	}
+
+	for version, logged := range map[string]string{
+		"1.22":          "tag:go1.22.3",
+		"1.22.1":        "tag:go1.22.1",
+		"1.22.1+cgo":    "tag:go1.22.1+cgo",
+		":tip":          "bra:master",
+		"src:" + srcDir: "src:" + srcDir + "@0123456789abcdef",
+	} {
+		var out bytes.Buffer
+		gotv.stdout = &out
+		if err := gotv.showBuildLog(version); err != nil {
+			t.Errorf("showBuildLog(%s) error: %s", version, err)
+			continue
+		}
+		if !strings.Contains(out.String(), "Version: "+logged+"\n") {
+			t.Errorf("the build log of %s should be shown for %s:\n%s", logged, version, out.String())
+		}
+	}
+
+	if err := gotv.showBuildLog("1.21"); err == nil || !strings.Contains(err.Error(), "no build logs") {
+		t.Errorf("no build logs should be found for 1.21, but got %v", err)
+	}
+	if gotv.repositoryExists() {
+		t.Error("the repository should not be cloned")
+	}
+}
+
+func Test_exportVersion_NotCached(t *testing.T) {
+	gotv, err := bornWithCacheAndConfigDir(t.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotv.stdin, gotv.stdout, gotv.stderr = nil, io.Discard, io.Discard
+
+	var archive = filepath.Join(t.TempDir(), "go.tar.gz")
+	for _, version := range []string{"1.22.1", "1.22", ":tip", "bra:master"} {
+		if err := gotv.exportVersion("-o", archive, version); err == nil || !strings.Contains(err.Error(), "not cached") {
+			t.Errorf("exporting %s should fail for it is not cached, but got %v", version, err)
+		}
+	}
+	if gotv.repositoryExists() {
+		t.Error("the repository should not be cloned")
+	}
+
+	var tv = parseGoToolchainVersion("tag:go1.22.1", true)
+	var toolchainDir = filepath.Join(gotv.cacheDir, tv.folderName())
+	if err := os.MkdirAll(filepath.Join(toolchainDir, "bin"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(toolchainDir, "bin", goCommandFilename(buildOptions{})), nil, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeToolchainInfo(toolchainDir, toolchainInfo{Revision: "aaa", Version: tv.String()}); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"1.22.1", "1.22"} {
+		if err := gotv.exportVersion("-o", archive, version); err != nil {
+			t.Errorf("exporting %s error: %s", version, err)
+		}
+	}
+	if _, err := os.Stat(archive); err != nil {
+		t.Errorf("the archive should be written: %s", err)
+	}
+}
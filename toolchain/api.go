@@ -0,0 +1,223 @@
+// Package toolchain manages Go toolchains built from the Go git
+// repository. It is used by the gotv program, and it can also be
+// used to manage toolchains programmatically, for example:
+//
+//	gotv, err := toolchain.New(toolchain.Options{
+//		RepositoryURL: "https://go.googlesource.com/go",
+//	})
+//	...
+//	v, err := toolchain.ParseVersion("1.21")
+//	...
+//	cmd, err := gotv.Command(ctx, v, "build", "./...")
+//	...
+//	err = cmd.Run()
+//
+// Except RunCommand, the methods of a GoTV value are safe to call
+// concurrently. The operations on the Go git repository, which is
+// shared by the calls, are serialized.
+package toolchain
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Options are used to create GoTV values.
+type Options struct {
+	// The toolchains are cached in the gotv subdirectory.
+	// If it is blank, the user cache directory is used.
+	CacheDir string
+
+	// The config file is in the gotv subdirectory.
+	// If it is blank, the user config directory is used.
+	ConfigDir string
+
+	// The URL used to clone the Go git repository when it hasn't
+	// been cloned yet. If it is blank, the URL is asked from Stdin.
+	RepositoryURL string
+
+	// The user is asked for the repository URL and ssh key files
+	// (if needed) from it. If it is nil, the user is never asked,
+	// and the operations needing user input fail with errors.
+	Stdin io.Reader
+
+	// The progress of syncing the repository and building toolchains
+	// is written to them. If they are nil, os.Stdout and os.Stderr
+	// are used. Use io.Discard to hide the progress.
+	Stdout, Stderr io.Writer
+
+	// If it is not nil, the progress events of syncing the
+	// repository and building toolchains are reported to it,
+	// instead of being printed to Stdout.
+	Reporter Reporter
+
+	// In offline mode, the network is never accessed. Versions are
+	// resolved from the local repository, or from the cached
+	// toolchains if the repository doesn't exist. Operations
+	// needing network access fail with errors.
+	Offline bool
+}
+
+// New creates a GoTV value.
+func New(opts Options) (*GoTV, error) {
+	var gotv GoTV
+	var err error
+	if opts.CacheDir == "" && opts.ConfigDir == "" {
+		gotv, err = born()
+	} else {
+		if opts.CacheDir == "" {
+			if opts.CacheDir, err = os.UserCacheDir(); err != nil {
+				return nil, err
+			}
+		}
+		if opts.ConfigDir == "" {
+			if opts.ConfigDir, err = os.UserConfigDir(); err != nil {
+				return nil, err
+			}
+		}
+		if opts.CacheDir, err = filepath.Abs(opts.CacheDir); err != nil {
+			return nil, err
+		}
+		if opts.ConfigDir, err = filepath.Abs(opts.ConfigDir); err != nil {
+			return nil, err
+		}
+		gotv, err = bornWithCacheAndConfigDir(opts.CacheDir, opts.ConfigDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	gotv.repositoryURL = opts.RepositoryURL
+	gotv.offline = opts.Offline
+	gotv.stdin = opts.Stdin
+	if opts.Stdout != nil {
+		gotv.stdout = opts.Stdout
+		gotv.reporter = NewTerminalReporter(gotv.stdout)
+	}
+	if opts.Reporter != nil {
+		gotv.reporter = opts.Reporter
+	}
+	if opts.Stderr != nil {
+		gotv.stderr = opts.Stderr
+	}
+	return &gotv, nil
+}
+
+// A Version is a toolchain version, such as 1.21, :tip, bra:master,
+// rev:abcdef0 and src:~/go-dev, optionally with build options, such
+// as 1.21+cgo. See the usage of the gotv program for details.
+type Version struct {
+	tv toolchainVersion
+}
+
+// ParseVersion parses a toolchain version.
+func ParseVersion(version string) (Version, error) {
+	var tv = parseGoToolchainVersion(version, true)
+	if invalid, message := tv.IsInvalid(); invalid {
+		return Version{}, errors.New(message)
+	}
+	return Version{tv}, nil
+}
+
+func (v Version) String() string {
+	return v.tv.String()
+}
+
+// IsResolved reports whether or not v is a resolved version,
+// which is a tag, branch, revision or hashed source version.
+func (v Version) IsResolved() bool {
+	switch v.tv.kind {
+	case kind_Tag, kind_Branch, kind_Revision:
+		return true
+	case kind_Source:
+		var _, hash = splitSourceVersion(v.tv.version)
+		return hash != ""
+	}
+	return false
+}
+
+// DefaultVersion returns the default version set by the
+// "gotv default-version" command. ok is false if it is not set.
+func (gotv *GoTV) DefaultVersion() (v Version, ok bool) {
+	var tv = gotv.defaultVersion()
+	if invalid, _ := tv.IsInvalid(); invalid {
+		return Version{}, false
+	}
+	return Version{tv}, true
+}
+
+// SyncRepository clones the Go git repository if it hasn't been
+// cloned, otherwise, fetches the updates of all the remotes.
+func (gotv *GoTV) SyncRepository(ctx context.Context) error {
+	var g = gotv.withContext(ctx)
+	defer g.lockRepository()()
+	_, err := g.ensureGoRepository(true)
+	return err
+}
+
+// Resolve resolves a version to a tag, branch, revision or hashed
+// source version, such as 1.21 to tag:go1.21.5, and :tip to
+// bra:master. Build options are kept.
+func (gotv *GoTV) Resolve(ctx context.Context, v Version) (Version, error) {
+	var g = gotv.withContext(ctx)
+	if err := g.prepareToolchainVersion(&v.tv); err != nil {
+		return Version{}, err
+	}
+	v.tv.forceSyncRepo = false
+	return v, nil
+}
+
+// A Toolchain is a built toolchain.
+type Toolchain struct {
+	Version Version // resolved
+	GOROOT  string
+}
+
+// Ensure builds the toolchain of a version if it hasn't been built.
+func (gotv *GoTV) Ensure(ctx context.Context, v Version) (Toolchain, error) {
+	var g = gotv.withContext(ctx)
+	goroot, err := g.ensureToolchainVersion(&v.tv, false)
+	if err != nil {
+		return Toolchain{}, err
+	}
+	v.tv.forceSyncRepo = false
+	return Toolchain{Version: v, GOROOT: goroot}, nil
+}
+
+// Command builds the toolchain of a version if it hasn't been built,
+// then returns a go command of the toolchain with the specified
+// arguments, just like the one run by "gotv Version args...". The
+// environment of the command includes the default envs and cache
+// settings of the version. The Stdin, Stdout and Stderr fields of
+// the command are unset.
+func (gotv *GoTV) Command(ctx context.Context, v Version, args ...string) (*exec.Cmd, error) {
+	if v.tv.options.isCrossCompiled() {
+		return nil, errors.New("toolchain " + v.String() + " can't run on this host")
+	}
+
+	var g = gotv.withContext(ctx)
+	var specified = v.tv
+	goroot, err := g.ensureToolchainVersion(&v.tv, false)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := g.completeGoCommandOptions(specified, v.tv, goCommandOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var binDir = filepath.Join(goroot, "bin")
+	var path = binDir
+	if oldpath := os.Getenv("PATH"); oldpath != "" {
+		path += string(os.PathListSeparator) + oldpath
+	}
+
+	var cmd = exec.CommandContext(ctx, filepath.Join(binDir, goCommandFilename(v.tv.options)), args...)
+	cmd.Env = append(os.Environ(), "PATH="+path, "GOTOOLCHAIN=local")
+	cmd.Env = append(cmd.Env, opts.envs...) // later ones take effect
+	return cmd, nil
+}
@@ -0,0 +1,134 @@
+package toolchain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The file recording the time of the last fetch is in the .git
+// directory of the repository, so that it is removed along with
+// the repository.
+const lastFetchFile = "gotv-last-fetch"
+
+func recordFetchTime(repoDir string) {
+	var data = []byte(time.Now().UTC().Format(time.RFC3339) + "\n")
+	_ = os.WriteFile(filepath.Join(repoDir, ".git", lastFetchFile), data, 0644)
+}
+
+// lastFetchTime returns the time of the last fetch (or clone).
+// It returns the zero time if the time is not recorded.
+func lastFetchTime(repoDir string) time.Time {
+	data, err := os.ReadFile(filepath.Join(repoDir, ".git", lastFetchFile))
+	if err != nil {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	return t
+}
+
+// needsLatestVersions reports whether or not the resolution of a
+// version depends on how recently the repository was fetched.
+// Such versions are the pseudo release versions, such as 1.22.
+// and 1., and the aliases, such as :tip and :1.22.
+func needsLatestVersions(tv toolchainVersion) bool {
+	switch tv.kind {
+	case kind_Alias:
+		return true
+	case kind_Release:
+		var _, latest = releaseVersionPrefix(tv.version)
+		return latest
+	}
+	return false
+}
+
+func (gotv *GoTV) fetchInterval() time.Duration {
+	var config, err = gotv.loadConfig()
+	if err != nil || config.FetchInterval == "" {
+		return 0
+	}
+	d, _ := time.ParseDuration(config.FetchInterval)
+	return d
+}
+
+// autoFetch fetches the remote versions if any of the versions needs
+// the latest versions and the last fetch is older than the fetch
+// interval set by the fetch-interval command. Fetching failures
+// are only warned, so that the local versions are still usable.
+func (gotv *GoTV) autoFetch(tvs ...toolchainVersion) error {
+	if gotv.offline || !gotv.repositoryExists() {
+		return nil
+	}
+
+	var needed = false
+	for _, tv := range tvs {
+		if !tv.forceSyncRepo && needsLatestVersions(tv) {
+			needed = true
+			break
+		}
+	}
+	if !needed {
+		return nil
+	}
+
+	var interval = gotv.fetchInterval()
+	if interval <= 0 {
+		return nil
+	}
+	var last = lastFetchTime(gotv.repositoryDir)
+	if time.Since(last) < interval {
+		return nil
+	}
+
+	if last.IsZero() {
+		fmt.Fprintf(gotv.stdout, "The remote versions have not been fetched within the fetch interval (%s).\n", interval)
+	} else {
+		fmt.Fprintf(gotv.stdout, "The remote versions were fetched %s ago, longer than the fetch interval (%s).\n", time.Since(last).Round(time.Minute), interval)
+	}
+	if err := gotv.syncRepositoryAndReport(); err != nil {
+		if gotv.context().Err() != nil {
+			return err
+		}
+		fmt.Fprintf(gotv.stderr, "Failed to fetch the remote versions (%s), the local versions are used.\n", err)
+	}
+	fmt.Fprintln(gotv.stdout)
+	return nil
+}
+
+// setFetchInterval shows or sets the fetch interval.
+// An interval of 0 disables automatic fetching.
+func (gotv *GoTV) setFetchInterval(args ...string) error {
+	if len(args) > 1 {
+		return errors.New(`fetch-interval needs at most one argument`)
+	}
+
+	config, err := gotv.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if config.FetchInterval == "" {
+			fmt.Fprintln(gotv.stdout, "Automatic fetching is disabled.")
+		} else {
+			fmt.Fprintf(gotv.stdout, "Fetch interval: %s\n", config.FetchInterval)
+		}
+		return nil
+	}
+
+	interval, err := time.ParseDuration(args[0])
+	if err != nil || interval < 0 {
+		return fmt.Errorf("invalid fetch interval: %s (should be a duration, such as 24h)", args[0])
+	}
+	if interval == 0 {
+		config.FetchInterval = ""
+		fmt.Fprintln(gotv.stdout, "Automatic fetching is disabled now.")
+	} else {
+		config.FetchInterval = interval.String()
+		fmt.Fprintf(gotv.stdout, "Fetch interval is set as %s now.\n", interval)
+	}
+	return gotv.saveConfig(config)
+}
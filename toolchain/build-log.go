@@ -0,0 +1,246 @@
+package toolchain
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A buildLog records the whole process of building a toolchain.
+// Build logs are kept out of toolchain folders, so that the logs
+// for failed builds are still available for diagnosing later.
+type buildLog struct {
+	path  string
+	file  *os.File
+	start time.Time
+}
+
+func (gotv *GoTV) buildLogsDir() string {
+	return filepath.Join(gotv.cacheDir, "build-logs")
+}
+
+func (gotv *GoTV) buildLogPath(tv toolchainVersion) string {
+	return filepath.Join(gotv.buildLogsDir(), tv.folderName()+".log")
+}
+
+func openBuildLog(path string, flag int) (*buildLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &buildLog{path: path, file: f, start: time.Now()}, nil
+}
+
+// The log for the last build of the same version is overwritten.
+func (gotv *GoTV) createBuildLog(tv toolchainVersion, revision string) (*buildLog, error) {
+	log, err := openBuildLog(gotv.buildLogPath(tv), os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+
+	log.printf("Version: %s\n", tv)
+	log.printf("Revision: %s\n", revision)
+	log.printf("Started: %s\n", log.start.Format(time.RFC3339))
+	return log, nil
+}
+
+// appendBuildLog is used to log the processes happening after
+// a toolchain is built, such as verification.
+func (gotv *GoTV) appendBuildLog(tv toolchainVersion) (*buildLog, error) {
+	log, err := openBuildLog(gotv.buildLogPath(tv), os.O_APPEND)
+	if err != nil {
+		return nil, err
+	}
+
+	log.printf("\n----\nStarted: %s\n", log.start.Format(time.RFC3339))
+	return log, nil
+}
+
+func (log *buildLog) printf(format string, args ...interface{}) {
+	fmt.Fprintf(log.file, format, args...)
+}
+
+func (log *buildLog) Write(p []byte) (int, error) {
+	return log.file.Write(p)
+}
+
+func (log *buildLog) finish(buildErr error) {
+	log.printf("\nDuration: %s\n", time.Since(log.start).Round(time.Millisecond))
+
+	var ee *exec.ExitError
+	switch {
+	case buildErr == nil:
+		log.printf("Exit code: 0\n")
+	case errors.As(buildErr, &ee):
+		log.printf("Exit code: %d\n", ee.ExitCode())
+	default:
+		log.printf("Error: %s\n", buildErr)
+	}
+
+	log.file.Close()
+}
+
+// showBuildLog never accesses the network. The version is resolved
+// with the local repository or the cached toolchains. If it can't be
+// resolved so (or it is an unhashed source tree, which is not hashed
+// again), the build logs of the matching versions are looked up.
+func (gotv *GoTV) showBuildLog(version string) error {
+	var tv = parseGoToolchainVersion(version, true)
+	if invalid, message := tv.IsInvalid(); invalid {
+		return errors.New(message)
+	}
+
+	if tv.forceSyncRepo {
+		fmt.Fprintln(gotv.stdout, "The ! sign is ignored.")
+		tv.forceSyncRepo = false
+	}
+	if err := tv.options.resolvePatches(); err != nil {
+		return err
+	}
+
+	var path string
+	switch tv.kind {
+	case kind_Tag, kind_Branch, kind_Revision:
+		path = gotv.buildLogPath(tv)
+	case kind_Source:
+		if _, hash := splitSourceVersion(tv.version); hash != "" {
+			path = gotv.buildLogPath(tv)
+		}
+	default:
+		if resolved, ok := gotv.resolveVersionLocally(tv); ok {
+			path = gotv.buildLogPath(resolved)
+		}
+	}
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			path = ""
+		}
+	}
+	if path == "" {
+		logged, logPath, err := gotv.matchBuildLog(tv)
+		if err != nil {
+			return err
+		}
+		if logPath == "" {
+			return fmt.Errorf("no build logs found for %s", tv)
+		}
+		fmt.Fprintf(gotv.stdout, "The build log of %s is shown.\n\n", logged)
+		path = logPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = gotv.stdout.Write(data)
+	return err
+}
+
+// matchBuildLog looks up the build log of the version matching an
+// unresolved version, by the versions recorded in the build logs and
+// the log file names (which also reflect the build options): the
+// latest release for a pseudo release version, or the last built one
+// for others. The returned path is blank if none matches.
+func (gotv *GoTV) matchBuildLog(tv toolchainVersion) (logged toolchainVersion, path string, err error) {
+	entries, err := os.ReadDir(gotv.buildLogsDir())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+
+	var matches = func(v toolchainVersion) bool {
+		switch tv.kind {
+		case kind_Release:
+			var release = releaseOfTag(v.version)
+			if v.kind != kind_Tag || release == "" {
+				return false
+			}
+			if prefix, latest := releaseVersionPrefix(tv.version); latest {
+				return strings.HasPrefix(release, prefix)
+			}
+			return release == tv.version
+		case kind_Alias:
+			if v.kind != kind_Branch {
+				return false
+			}
+			if tv.version == "tip" {
+				return v.version == "master"
+			}
+			return releaseOfBranch(v.version) == tv.version
+		case kind_Source:
+			var dir, _ = splitSourceVersion(v.version)
+			return v.kind == kind_Source && dir == tv.version
+		}
+		return false
+	}
+
+	var modTime time.Time
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		var logPath = filepath.Join(gotv.buildLogsDir(), e.Name())
+		v, ok := readBuildLogVersion(logPath)
+		if !ok || !matches(v) {
+			continue
+		}
+		// The versions in logs don't record the patch hashes.
+		if e.Name() != v.folderName()+tv.options.folderSuffix()+".log" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		var newer bool
+		if tv.kind == kind_Release {
+			newer = compareVersions(releaseOfTag(logged.version), releaseOfTag(v.version))
+		} else {
+			newer = info.ModTime().After(modTime)
+		}
+		if path == "" || newer {
+			v.options = tv.options
+			logged, path, modTime = v, logPath, info.ModTime()
+		}
+	}
+	return logged, path, nil
+}
+
+// readBuildLogVersion reads the version in the first line of a build
+// log. The build options of the version are dropped.
+func readBuildLogVersion(path string) (tv toolchainVersion, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var line, _ = bufio.NewReader(f).ReadString('\n')
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "Version: ") {
+		return
+	}
+	tv = parseGoToolchainVersion(strings.TrimPrefix(line, "Version: "), true)
+	switch tv.kind {
+	case kind_Tag, kind_Branch, kind_Revision:
+	case kind_Source:
+		if _, hash := splitSourceVersion(tv.version); hash == "" {
+			return
+		}
+	default:
+		return
+	}
+	tv.options = buildOptions{}
+	return tv, true
+}
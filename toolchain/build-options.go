@@ -0,0 +1,214 @@
+package toolchain
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// buildOptions are the settings used to build a toolchain.
+// They are specified as version suffixes, such as
+//
+//	1.21+cgo
+//	1.21+exp=rangefunc
+//	1.21+goamd64=v3
+//	1.21+target=linux/arm64
+//	1.21+patch=./fix.diff
+//	1.21+cgo+exp=rangefunc,loopvar+goamd64=v3
+//
+// Differently configured toolchains are cached in different folders.
+//
+// Note: the type must be kept comparable, for toolchainVersion
+// values are used as map keys.
+type buildOptions struct {
+	cgo        bool
+	experiment string // sorted and comma separated GOEXPERIMENT items
+	goamd64    string
+
+	// The target platform of a cross-compiled toolchain.
+	// Both are blank for native toolchains.
+	goos, goarch string
+
+	// The absolute path of a patch file or a directory containing
+	// patch files, which are applied to the source tree before
+	// building. The hash of the patches is used in folder names
+	// instead (see resolvePatches).
+	patch, patchHash string
+}
+
+func parseBuildOptions(options string) (opts buildOptions, err error) {
+	var experiments []string
+	for _, opt := range strings.Split(options, "+") {
+		opt = strings.TrimSpace(opt)
+		var name, value = opt, ""
+		if i := strings.IndexByte(opt, '='); i >= 0 {
+			name, value = opt[:i], opt[i+1:]
+		}
+
+		switch name {
+		default:
+			err = fmt.Errorf("unknown build option: %s", opt)
+			return
+		case "":
+			err = fmt.Errorf("empty build option")
+			return
+		case "cgo":
+			if value != "" {
+				err = fmt.Errorf("build option cgo takes no values")
+				return
+			}
+			opts.cgo = true
+		case "exp":
+			for _, e := range strings.Split(value, ",") {
+				if !isValidExperimentName(e) {
+					err = fmt.Errorf("invalid GOEXPERIMENT item: %q", e)
+					return
+				}
+				experiments = append(experiments, e)
+			}
+		case "goamd64":
+			switch value {
+			default:
+				err = fmt.Errorf("invalid GOAMD64 value: %q (should be v1, v2, v3 or v4)", value)
+				return
+			case "v1", "v2", "v3", "v4":
+			}
+			opts.goamd64 = value
+		case "target":
+			var i = strings.IndexByte(value, '/')
+			if i < 0 || !isValidPlatformName(value[:i]) || !isValidPlatformName(value[i+1:]) {
+				err = fmt.Errorf("invalid target: %q (should be in the form of GOOS/GOARCH)", value)
+				return
+			}
+			opts.goos, opts.goarch = value[:i], value[i+1:]
+		case "patch":
+			if value == "" {
+				err = fmt.Errorf("build option patch needs a file or directory path")
+				return
+			}
+			if opts.patch != "" {
+				err = fmt.Errorf("build option patch is specified more than once")
+				return
+			}
+			if opts.patch, err = filepath.Abs(expandHomeDir(value)); err != nil {
+				return
+			}
+		}
+	}
+
+	if len(experiments) > 0 {
+		sort.Strings(experiments)
+		var k = 0
+		for i, e := range experiments {
+			if i == 0 || e != experiments[k-1] {
+				experiments[k] = e
+				k++
+			}
+		}
+		opts.experiment = strings.Join(experiments[:k], ",")
+	}
+
+	return
+}
+
+func isValidExperimentName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z':
+		case 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9':
+		case c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isValidPlatformName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// The result is empty for default options, otherwise it starts with "+".
+func (opts buildOptions) String() string {
+	var b strings.Builder
+	if opts.cgo {
+		b.WriteString("+cgo")
+	}
+	if opts.experiment != "" {
+		b.WriteString("+exp=")
+		b.WriteString(opts.experiment)
+	}
+	if opts.goamd64 != "" {
+		b.WriteString("+goamd64=")
+		b.WriteString(opts.goamd64)
+	}
+	if opts.goos != "" {
+		b.WriteString("+target=")
+		b.WriteString(opts.target())
+	}
+	if opts.patch != "" {
+		b.WriteString("+patch=")
+		b.WriteString(opts.patch)
+	}
+	return b.String()
+}
+
+// folderSuffix is like String, but it is used in cache folder names.
+func (opts buildOptions) folderSuffix() string {
+	if opts.patch != "" {
+		if opts.patchHash == "" {
+			panic("patches are not resolved: " + opts.patch)
+		}
+		var patchHash = opts.patchHash
+		opts.patch, opts.patchHash = "", ""
+		return opts.folderSuffix() + "+patch=" + patchHash
+	}
+	return strings.Replace(opts.String(), "/", "_", -1)
+}
+
+func (opts buildOptions) target() string {
+	if opts.goos == "" {
+		return ""
+	}
+	return opts.goos + "/" + opts.goarch
+}
+
+// isCrossCompiled reports whether or not the built toolchain
+// is unable to run on the current host.
+func (opts buildOptions) isCrossCompiled() bool {
+	return opts.goos != "" && (opts.goos != runtime.GOOS || opts.goarch != runtime.GOARCH)
+}
+
+// The environment variables passed to make.bash.
+func (opts buildOptions) buildEnvs() []string {
+	var envs = make([]string, 0, 5)
+	if opts.cgo {
+		envs = append(envs, "CGO_ENABLED=1")
+	} else {
+		envs = append(envs, "CGO_ENABLED=0")
+	}
+	if opts.experiment != "" {
+		envs = append(envs, "GOEXPERIMENT="+opts.experiment)
+	}
+	if opts.goamd64 != "" {
+		envs = append(envs, "GOAMD64="+opts.goamd64)
+	}
+	if opts.goos != "" {
+		envs = append(envs, "GOOS="+opts.goos, "GOARCH="+opts.goarch)
+	}
+	return envs
+}
@@ -0,0 +1,107 @@
+package toolchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go101.org/gotv/internal/util"
+)
+
+// patchFiles returns the patch files specified by the patch build option.
+// If the option specifies a directory, then the .patch and .diff files
+// in the directory are returned, sorted by name.
+func (opts buildOptions) patchFiles() ([]string, error) {
+	info, err := os.Stat(opts.patch)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{opts.patch}, nil
+	}
+
+	entries, err := os.ReadDir(opts.patch)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if name := e.Name(); strings.HasSuffix(name, ".patch") || strings.HasSuffix(name, ".diff") {
+			files = append(files, filepath.Join(opts.patch, name))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .patch or .diff files found in %s", opts.patch)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+const patchHashLength = 16
+
+func isPatchHash(s string) bool {
+	return isLowerHex(s, patchHashLength)
+}
+
+// resolvePatches computes the hash of the patch files,
+// so that differently patched toolchains are cached
+// in different folders.
+func (opts *buildOptions) resolvePatches() error {
+	if opts.patch == "" || opts.patchHash != "" {
+		return nil
+	}
+
+	files, err := opts.patchFiles()
+	if err != nil {
+		return err
+	}
+
+	var h = sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%d\n", len(data))
+		h.Write(data)
+	}
+	opts.patchHash = hex.EncodeToString(h.Sum(nil))[:patchHashLength]
+	return nil
+}
+
+// applyPatches applies patch files to the source of a toolchain
+// with the git command, before the toolchain is built.
+func (gotv *GoTV) applyPatches(version string, files []string, toolchainDir string, log io.Writer) (err error) {
+	var finish = startPhase(gotv.report, PhasePatch, version, "")
+	defer func() {
+		finish(0, err)
+	}()
+
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return errors.New("the git command is needed to apply patches")
+	}
+
+	for _, file := range files {
+		gotv.reportCommand(version, "git apply", gotv.replaceHomeDir(file))
+		fmt.Fprintf(log, "Apply patch: %s\n", file)
+
+		_, err := util.RunShellCommandContext(gotv.context(), time.Minute, toolchainDir, nil, nil, io.MultiWriter(gotv.stdout, log), io.MultiWriter(gotv.stderr, log), gitPath, "apply", "--whitespace=nowarn", file)
+		if err != nil {
+			return fmt.Errorf("failed to apply patch %s: %w", file, err)
+		}
+	}
+
+	return nil
+}
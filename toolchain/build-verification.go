@@ -0,0 +1,163 @@
+package toolchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"go101.org/gotv/internal/util"
+)
+
+// verifyOptions are specified by the -verify and -verify-run
+// options of the cache-version command. A verified toolchain
+// has passed the tests in the Go repository.
+type verifyOptions struct {
+	enabled bool
+	run     string // the regexp passed to "go tool dist test -run"
+}
+
+// verificationInfo is recorded in gotv.info files.
+// Toolchains built with verification are only kept if they pass it.
+// A failed verification of a cached toolchain is recorded instead,
+// so that the toolchain is rebuilt when it is verified again.
+type verificationInfo struct {
+	Command  string `json:"command"`
+	Passed   bool   `json:"passed"`
+	Duration string `json:"duration"`
+	Time     string `json:"time"`
+}
+
+// The returned command path is relative to the src directory.
+func (opts verifyOptions) command() []string {
+	if opts.run != "" {
+		return []string{filepath.Join("..", "bin", "go"), "tool", "dist", "test", "-run", opts.run}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"run.bat", "--no-rebuild"}
+	}
+	return []string{"./run.bash", "--no-rebuild"}
+}
+
+// matches reports whether or not a toolchain has been verified
+// by the same command.
+func (info *verificationInfo) matches(opts verifyOptions) bool {
+	return info != nil && info.Passed && info.Command == strings.Join(opts.command(), " ")
+}
+
+// failed reports whether or not a toolchain has failed the
+// verification by the same command.
+func (info *verificationInfo) failed(opts verifyOptions) bool {
+	return info != nil && !info.Passed && info.Command == strings.Join(opts.command(), " ")
+}
+
+func (gotv *GoTV) verifyToolchain(tv toolchainVersion, toolchainDir string, log *buildLog) (*verificationInfo, error) {
+	if tv.options.isCrossCompiled() {
+		return nil, fmt.Errorf("toolchain %s is built for %s, it can't be verified on this host", tv, tv.options.target())
+	}
+
+	var srcDir = filepath.Join(toolchainDir, "src")
+	var command = gotv.verify.command()
+	fmt.Fprintln(gotv.stdout, "[Run]: cd", gotv.replaceHomeDir(srcDir))
+	fmt.Fprintln(gotv.stdout, "[Run]:", strings.Join(command, " "))
+
+	var optionEnvs = tv.options.buildEnvs()
+	buildEnvs := func() []string {
+		var path = filepath.Join(toolchainDir, "bin")
+		if oldpath := os.Getenv("PATH"); oldpath != "" {
+			path += string(os.PathListSeparator) + oldpath
+		}
+		return append([]string{
+			"GOROOT=" + toolchainDir,
+			"GOTOOLCHAIN=local",
+			"PATH=" + path,
+		}, optionEnvs...)
+	}
+
+	log.printf("\nVerification: %s\n\n", strings.Join(command, " "))
+
+	var start = time.Now()
+	var cmdAndArgs = append([]string{filepath.Join(srcDir, command[0])}, command[1:]...)
+	var failed = &failedChecks{}
+	var stdout, stderr = failed.lineWriter(), failed.lineWriter()
+	_, err := util.RunShellContext(gotv.context(), 3*time.Hour, srcDir, buildEnvs, nil, io.MultiWriter(gotv.stdout, log, stdout), io.MultiWriter(gotv.stderr, log, stderr), cmdAndArgs...)
+	stdout.Flush()
+	stderr.Flush()
+	var info = &verificationInfo{
+		Command:  strings.Join(command, " "),
+		Passed:   err == nil,
+		Duration: time.Since(start).Round(time.Second).String(),
+		Time:     start.Format(time.RFC3339),
+	}
+	log.printf("\nVerification passed: %v (%s)\n", info.Passed, info.Duration)
+	fmt.Fprintln(gotv.stdout)
+
+	if err != nil {
+		// A newly built toolchain (with its gotv.info file) is removed,
+		// so the failure is also recorded in the build log.
+		if data, err := json.Marshal(info); err == nil {
+			log.printf("Verification record: %s\n", data)
+		}
+		log.printf("Verification error: %s\n", err)
+		if len(failed.lines) > 0 {
+			log.printf("Failed checks:\n\t%s\n", strings.Join(failed.lines, "\n\t"))
+		}
+		return info, fmt.Errorf("verification of %s failed: %w", tv, err)
+	}
+	return info, nil
+}
+
+// At most so many lines of failed checks are recorded.
+const maxFailedChecks = 100
+
+// failedChecks collects the lines reporting failed checks, such as
+// "--- FAIL: TestX" and "FAIL pkg", in the outputs of verification.
+type failedChecks struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (fc *failedChecks) lineWriter() *eventLineWriter {
+	return &eventLineWriter{handle: fc.add}
+}
+
+func (fc *failedChecks) add(line string) {
+	var trimmed = strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "--- FAIL") && !strings.HasPrefix(trimmed, "FAIL") && !strings.HasPrefix(trimmed, "Failed:") {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if len(fc.lines) < maxFailedChecks {
+		fc.lines = append(fc.lines, trimmed)
+	}
+}
+
+// verifyCachedToolchain verifies a toolchain which was built without
+// verification. The toolchain is kept if the verification fails, but
+// the failure is recorded in its gotv.info file.
+func (gotv *GoTV) verifyCachedToolchain(tv toolchainVersion, toolchainDir string, info toolchainInfo) (err error) {
+	log, err := gotv.appendBuildLog(tv)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		log.finish(err)
+		if err != nil {
+			err = fmt.Errorf("%w\n\nThe build log is kept in %s", err, gotv.replaceHomeDir(log.path))
+		}
+	}()
+
+	info.Verification, err = gotv.verifyToolchain(tv, toolchainDir, log)
+	if info.Verification != nil {
+		if err := writeToolchainInfo(toolchainDir, info); err != nil {
+			return err
+		}
+	}
+	return err
+}
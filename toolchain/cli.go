@@ -0,0 +1,56 @@
+package toolchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RunCommand runs a gotv command line (without the program name),
+// either a gotv specific command, such as
+//
+//	cache-version 1.21 1.22
+//
+// or a go command run with a toolchain version, such as
+//
+//	1.21 -env:CGO_ENABLED=1 build ./...
+//
+// If the go command fails, the returned error is an *exec.ExitError.
+func (gotv *GoTV) RunCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("no arguments")
+	}
+
+	err := gotv.tryRunningSpecialCommand(args)
+	if err != (unknownCommand{}) {
+		return err
+	}
+
+	if tv := parseGoToolchainVersion(args[0], false); tv.kind == kind_Default || isGoCommandOption(args[0]) {
+		opts, goArgs, err := parseGoCommandOptions(args)
+		if err != nil {
+			return err
+		}
+
+		tv = gotv.defaultVersion()
+		if invalid, _ := tv.IsInvalid(); invalid {
+			//fmt.Print(".\n\n")
+			//printSetDefaultVersion(program)
+			//os.Exit(1)
+			fmt.Fprint(gotv.stdout, "No toolchain version is provided, try to use the latest release version.\n\n")
+			tv = parseGoToolchainVersion(".", true)
+		} else {
+			fmt.Fprintf(gotv.stdout, "No toolchain version is provided, try to use default version (%v).\n\n", tv)
+		}
+
+		return gotv.tryRunningGoToolchainCommand(tv, opts, goArgs)
+	} else if invalid, message := tv.IsInvalid(); invalid {
+		return errors.New(message)
+	} else {
+		opts, goArgs, err := parseGoCommandOptions(args[1:])
+		if err != nil {
+			return err
+		}
+
+		return gotv.tryRunningGoToolchainCommand(tv, opts, goArgs)
+	}
+}
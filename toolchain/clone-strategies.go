@@ -0,0 +1,523 @@
+package toolchain
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	"go101.org/gotv/internal/util"
+)
+
+// The strategies to clone the Go git repository, chosen by init-repo.
+// Except the full one, they fetch less history to save time and space.
+// The missing tags, branches and revisions are fetched on demand.
+const (
+	cloneStrategy_Full         = "full"          // the default
+	cloneStrategy_ReleaseTags  = "release-tags"  // only the release tags
+	cloneStrategy_SingleBranch = "single-branch" // only the master branch
+	cloneStrategy_Blobless     = "blobless"      // a partial clone (git command needed)
+)
+
+func isValidCloneStrategy(strategy string) bool {
+	switch strategy {
+	case cloneStrategy_Full, cloneStrategy_ReleaseTags, cloneStrategy_SingleBranch, cloneStrategy_Blobless:
+		return true
+	}
+	return false
+}
+
+// The file recording the clone options is in the .git directory
+// of the repository. It is absent for repositories cloned fully.
+const cloneInfoFile = "gotv-clone.info"
+
+type cloneOptions struct {
+	Strategy string `json:"strategy"`
+	Depth    int    `json:"depth,omitempty"` // 0 means unlimited
+}
+
+func (opts cloneOptions) String() string {
+	var s = opts.Strategy
+	if s == "" {
+		s = cloneStrategy_Full
+	}
+	if opts.Depth > 0 {
+		s += ", depth " + strconv.Itoa(opts.Depth)
+	}
+	return s
+}
+
+// isPartial reports whether or not some tags, branches or revisions
+// might be absent in the repository. Blobless clones have all of them,
+// but the file contents are fetched on demand.
+func (opts cloneOptions) isPartial() bool {
+	return opts.Strategy == cloneStrategy_ReleaseTags || opts.Strategy == cloneStrategy_SingleBranch || opts.Depth > 0
+}
+
+func readCloneOptions(repoDir string) (opts cloneOptions) {
+	data, err := os.ReadFile(filepath.Join(repoDir, ".git", cloneInfoFile))
+	if err != nil || json.Unmarshal(data, &opts) != nil {
+		return cloneOptions{}
+	}
+	return opts
+}
+
+func writeCloneOptions(repoDir string, opts cloneOptions) error {
+	var path = filepath.Join(repoDir, ".git", cloneInfoFile)
+	if !opts.isPartial() && opts.Strategy != cloneStrategy_Blobless {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(&opts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+const (
+	originBranchesRefSpec = "+refs/heads/*:refs/remotes/origin/*"
+	releaseTagsRefSpec    = "+refs/tags/go*:refs/tags/go*"
+)
+
+func tagRefSpec(tag string) string {
+	return "+refs/tags/" + tag + ":refs/tags/" + tag
+}
+
+func branchRefSpec(branch string) string {
+	return "+refs/heads/" + branch + ":refs/remotes/origin/" + branch
+}
+
+// initRepository implements the init-repo command, which clones the
+// Go git repository with a clone strategy.
+func (gotv *GoTV) initRepository(args ...string) error {
+	var flags = newFlagSet("init-repo")
+	var strategy = flags.String("strategy", cloneStrategy_Full, "")
+	var depth = flags.Int("depth", 0, "")
+	rest, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 1 {
+		return errors.New(`init-repo needs at most one non-option argument`)
+	}
+	if !isValidCloneStrategy(*strategy) {
+		return fmt.Errorf("invalid clone strategy: %s (should be one of full, release-tags, single-branch and blobless)", *strategy)
+	}
+	if *depth < 0 {
+		return errors.New(`the -depth option of init-repo must not be negative`)
+	}
+	if gotv.offline {
+		return offlineError("init-repo")
+	}
+	if gotv.repositoryExists() {
+		return fmt.Errorf("the Go git repository already exists (in %s)", gotv.replaceHomeDir(gotv.repositoryDir))
+	}
+
+	if len(rest) == 1 {
+		gotv.repositoryURL = rest[0]
+	}
+	gotv.cloneOptions = cloneOptions{Strategy: *strategy, Depth: *depth}
+	if _, err := gotv.ensureGoRepository(false); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(gotv.stdout, "The Go git repository is cloned (%s).\n", gotv.cloneOptions)
+	return nil
+}
+
+// gitCloneWithOptions clones a repository with a clone strategy other
+// than the full one. The clone options are recorded in the repository.
+func gitCloneWithOptions(ctx context.Context, repoAddr, toDir string, opts cloneOptions, auth gittransport.AuthMethod, progress io.Writer) error {
+	caBundle, err := gitCABundle()
+	if err != nil {
+		return err
+	}
+
+	switch opts.Strategy {
+	case cloneStrategy_Blobless:
+		var args = []string{"clone", "--progress", "--filter=blob:none"}
+		if opts.Depth > 0 {
+			args = append(args, "--depth="+strconv.Itoa(opts.Depth))
+		}
+		args = append(args, "--", repoAddr, toDir)
+		if err := runGitCommand(ctx, "", progress, args...); err != nil {
+			return err
+		}
+	case cloneStrategy_ReleaseTags:
+		repo, err := git.PlainInit(toDir, false)
+		if err != nil {
+			return err
+		}
+		_, err = repo.CreateRemote(&gitconfig.RemoteConfig{
+			Name:  git.DefaultRemoteName,
+			URLs:  []string{repoAddr},
+			Fetch: []gitconfig.RefSpec{releaseTagsRefSpec},
+		})
+		if err != nil {
+			return err
+		}
+		err = repo.FetchContext(ctx, &git.FetchOptions{
+			Auth:     auth,
+			Depth:    opts.Depth,
+			Progress: progress,
+			Tags:     git.NoTags,
+			Force:    true,
+			CABundle: caBundle,
+		})
+		if err != nil {
+			return err
+		}
+	default:
+		var o = git.CloneOptions{
+			Auth:     auth,
+			URL:      repoAddr,
+			Depth:    opts.Depth,
+			Progress: progress,
+			CABundle: caBundle,
+		}
+		if opts.Strategy == cloneStrategy_SingleBranch {
+			o.ReferenceName = plumbing.NewBranchReferenceName("master")
+			o.SingleBranch = true
+			o.Tags = git.NoTags
+		}
+		if _, err := git.PlainCloneContext(ctx, toDir, false, &o); err != nil {
+			return err
+		}
+	}
+
+	return writeCloneOptions(toDir, opts)
+}
+
+// runGitCommand runs a git command. The standard error of the command
+// is written to progress, and its last lines are included in errors.
+func runGitCommand(ctx context.Context, dir string, progress io.Writer, args ...string) error {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return fmt.Errorf("the git command is needed to run git %s", args[0])
+	}
+
+	var stderr bytes.Buffer
+	var errOutput io.Writer = &stderr
+	if progress != nil {
+		errOutput = io.MultiWriter(progress, &stderr)
+	}
+	_, err = util.RunShellCommandContext(ctx, 24*time.Hour, dir, nil, nil, io.Discard, errOutput, gitPath, args...)
+	if err != nil {
+		var lines = strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		if len(lines) > 3 {
+			lines = lines[len(lines)-3:]
+		}
+		return fmt.Errorf("git %s: %w\n%s", args[0], err, strings.Join(lines, "\n"))
+	}
+	return nil
+}
+
+// isPromisorRemote reports whether or not a remote is the promisor
+// remote of a partial clone, which must be fetched by the git command.
+func isPromisorRemote(repo *git.Repository, remoteName string) bool {
+	cfg, err := repo.Config()
+	if err != nil {
+		return false
+	}
+	var section = cfg.Raw.Section("remote")
+	if !section.HasSubsection(remoteName) {
+		return false
+	}
+	return section.Subsection(remoteName).Option("promisor") == "true"
+}
+
+// gitFetchRefSpecs fetches some refs from the origin remote and adds
+// the refspecs to the remote config, so that they are also updated
+// in later fetches. It is used to fetch missing tags and branches.
+func gitFetchRefSpecs(ctx context.Context, repoDir string, refSpecs []string, depth int, report func(Event), input *userInput) (err error) {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return err
+	}
+
+	var finish = startPhase(report, PhaseFetch, "", strings.Join(refSpecs, " "))
+	defer func() {
+		finish(0, err)
+	}()
+	var progress = newGitProgressWriter(report, PhaseFetch)
+	defer progress.Flush()
+
+	if isPromisorRemote(repo, git.DefaultRemoteName) {
+		var args = []string{"fetch", "--progress", "--no-tags"}
+		if depth > 0 {
+			args = append(args, "--depth="+strconv.Itoa(depth))
+		}
+		args = append(args, git.DefaultRemoteName)
+		args = append(args, refSpecs...)
+		if err = runGitCommand(ctx, repoDir, progress, args...); err != nil {
+			return err
+		}
+	} else {
+		remote, err := repo.Remote(git.DefaultRemoteName)
+		if err != nil {
+			return err
+		}
+		var remoteURL = remote.Config().URLs[0]
+		auth, err := gitAuth(remoteURL, remoteURL, input)
+		if err != nil {
+			return err
+		}
+		caBundle, err := gitCABundle()
+		if err != nil {
+			return err
+		}
+
+		var specs = make([]gitconfig.RefSpec, len(refSpecs))
+		for i, s := range refSpecs {
+			specs[i] = gitconfig.RefSpec(s)
+		}
+		_, err = retryWithCredentialHelper(remoteURL, auth, func(auth gittransport.AuthMethod) error {
+			return repo.FetchContext(ctx, &git.FetchOptions{
+				RefSpecs: specs,
+				Auth:     auth,
+				Depth:    depth,
+				Progress: progress,
+				Tags:     git.NoTags,
+				Force:    true,
+				CABundle: caBundle,
+			})
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return err
+		}
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	var remote = cfg.Remotes[git.DefaultRemoteName]
+	for _, s := range refSpecs {
+		var spec = gitconfig.RefSpec(s)
+		if !refSpecsContain(remote.Fetch, spec) {
+			remote.Fetch = append(remote.Fetch, spec)
+		}
+	}
+	return repo.SetConfig(cfg)
+}
+
+func refSpecsContain(specs []gitconfig.RefSpec, spec gitconfig.RefSpec) bool {
+	for _, s := range specs {
+		if s == spec || s.IsWildcard() && s.Match(plumbing.ReferenceName(spec.Src())) {
+			return true
+		}
+	}
+	return false
+}
+
+// gitDeepen fetches the complete history of all the branches and tags
+// in the origin remote, so that any revision in it is available.
+func gitDeepen(ctx context.Context, repoDir string, report func(Event), input *userInput) (err error) {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return err
+	}
+
+	var shallowFile = filepath.Join(repoDir, ".git", "shallow")
+	var _, statErr = os.Stat(shallowFile)
+	var shallow = statErr == nil
+
+	var finish = startPhase(report, PhaseFetch, "", "the complete history")
+	defer func() {
+		finish(0, err)
+	}()
+	var progress = newGitProgressWriter(report, PhaseFetch)
+	defer progress.Flush()
+
+	if isPromisorRemote(repo, git.DefaultRemoteName) {
+		var args = []string{"fetch", "--progress", "--tags"}
+		if shallow {
+			args = append(args, "--unshallow")
+		}
+		args = append(args, git.DefaultRemoteName, originBranchesRefSpec)
+		return runGitCommand(ctx, repoDir, progress, args...)
+	}
+
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return err
+	}
+	var remoteURL = remote.Config().URLs[0]
+	auth, err := gitAuth(remoteURL, remoteURL, input)
+	if err != nil {
+		return err
+	}
+	caBundle, err := gitCABundle()
+	if err != nil {
+		return err
+	}
+
+	var o = git.FetchOptions{
+		RefSpecs: []gitconfig.RefSpec{originBranchesRefSpec},
+		Progress: progress,
+		Tags:     git.AllTags,
+		Force:    true,
+		CABundle: caBundle,
+	}
+	if shallow {
+		o.Depth = 1<<31 - 1 // like "git fetch --unshallow"
+	}
+	_, err = retryWithCredentialHelper(remoteURL, auth, func(auth gittransport.AuthMethod) error {
+		o.Auth = auth
+		return repo.FetchContext(ctx, &o)
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	// The complete history is fetched, so the repository is not
+	// shallow any more. go-git doesn't remove the shallow file.
+	if shallow {
+		if err := os.Remove(shallowFile); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	cfg.Remotes[git.DefaultRemoteName].Fetch = []gitconfig.RefSpec{originBranchesRefSpec}
+	return repo.SetConfig(cfg)
+}
+
+// gitHasCommit reports whether or not a commit, specified by its full
+// or abbreviated hash, is in a repository.
+func gitHasCommit(repoDir, revision string) bool {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return false
+	}
+	var hash = plumbing.NewHash(revision)
+	if !isFullRevision(revision) {
+		// go-git only looks up abbreviated hashes in the loaded pack
+		// indexes, and they are loaded by the first object lookup.
+		_ = repo.Storer.HasEncodedObject(plumbing.ZeroHash)
+		resolved, err := repo.ResolveRevision(plumbing.Revision(revision))
+		if err != nil {
+			return false
+		}
+		hash = *resolved
+	}
+	_, err = repo.CommitObject(hash)
+	return err == nil
+}
+
+func (info repoInfo) hasReleaseWithPrefix(prefix string) bool {
+	for version := range info.releaseTags {
+		if strings.HasPrefix(version, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isFullRevision(revision string) bool {
+	if len(revision) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(revision)
+	return err == nil
+}
+
+// gitCheckoutWithCommand checks out a revision with the git command.
+// It is used for partial clones, whose missing objects are fetched
+// by the git command on demand.
+func gitCheckoutWithCommand(ctx context.Context, repoDir, revision string) error {
+	return runGitCommand(ctx, repoDir, nil, "checkout", "--force", "--quiet", "--detach", revision)
+}
+
+// completeRepository fetches the missing ref or revision of a version
+// in a partially cloned repository. It returns whether or not
+// something is fetched, in which case gotv.repoInfo is updated.
+func (gotv *GoTV) completeRepository(tv toolchainVersion) (fetched bool, err error) {
+	if gotv.offline || !gotv.repositoryExists() {
+		return false, nil
+	}
+	var opts = readCloneOptions(gotv.repositoryDir)
+	if !opts.isPartial() {
+		return false, nil
+	}
+
+	var refSpec string
+	switch tv.kind {
+	case kind_Tag:
+		if _, ok := gotv.repoInfo.allTags[tv.version]; !ok {
+			refSpec = tagRefSpec(tv.version)
+		}
+	case kind_Release:
+		if prefix, latest := releaseVersionPrefix(tv.version); !latest {
+			if _, ok := gotv.repoInfo.releaseTags[tv.version]; !ok {
+				refSpec = tagRefSpec("go" + tv.version)
+			}
+		} else if !gotv.repoInfo.hasReleaseWithPrefix(prefix) {
+			// Single-branch clones have no tags, so all the
+			// release tags are fetched to find the latest one.
+			refSpec = releaseTagsRefSpec
+		}
+	case kind_Branch:
+		// Only the branches in the origin remote are fetched on demand.
+		if _, ok := gotv.repoInfo.allBranches[tv.version]; !ok && !strings.Contains(tv.version, "/") {
+			refSpec = branchRefSpec(tv.version)
+		}
+	case kind_Alias:
+		if tv.version == "tip" {
+			if gotv.repoInfo.tipHash == "" {
+				refSpec = branchRefSpec("master")
+			}
+		} else if _, ok := gotv.repoInfo.versionBranches[tv.version]; !ok {
+			refSpec = branchRefSpec("release-branch.go" + tv.version)
+		}
+	case kind_Revision:
+		if !gitHasCommit(gotv.repositoryDir, tv.version) {
+			fmt.Fprintf(gotv.stdout, "Revision %s is not in the repository (cloned with the %s strategy), fetching the complete history.\n", tv.version, opts)
+			if err := gitDeepen(gotv.context(), gotv.repositoryDir, gotv.report, gotv.userInput()); err != nil {
+				return false, err
+			}
+			// All the branches and tags are fetched now.
+			var completed cloneOptions
+			if opts.Strategy == cloneStrategy_Blobless {
+				completed.Strategy = cloneStrategy_Blobless
+			}
+			if err := writeCloneOptions(gotv.repositoryDir, completed); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	if refSpec == "" {
+		return false, nil
+	}
+
+	fmt.Fprintf(gotv.stdout, "%s is not in the repository (cloned with the %s strategy), fetching it.\n", tv, opts)
+	gotv.reportCommand("", "git fetch origin", refSpec)
+	if err := gitFetchRefSpecs(gotv.context(), gotv.repositoryDir, []string{refSpec}, opts.Depth, gotv.report, gotv.userInput()); err != nil {
+		// The ref might not exist in the remote.
+		return false, fmt.Errorf("failed to fetch %s: %w", tv, err)
+	}
+
+	gotv.repoInfo, err = collectRepositoryInfo(gotv.repositoryDir)
+	return err == nil, err
+}
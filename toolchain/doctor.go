@@ -0,0 +1,299 @@
+package toolchain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// A doctorReport prints the results of the checks of the doctor
+// command. Each problem is printed with the commands to fix it.
+type doctorReport struct {
+	w        io.Writer
+	problems int
+}
+
+func (r *doctorReport) ok(format string, a ...interface{}) {
+	fmt.Fprintf(r.w, "[OK]   "+format+"\n", a...)
+}
+
+func (r *doctorReport) problem(fixes []string, format string, a ...interface{}) {
+	r.problems++
+	fmt.Fprintf(r.w, "[FAIL] "+format+"\n", a...)
+	for _, fix := range fixes {
+		fmt.Fprintf(r.w, "       Fix: %s\n", fix)
+	}
+}
+
+// doctor checks the Go git repository, the cached toolchains,
+// the bootstrap toolchain and the PATH setup. It never repairs
+// anything, but prints the commands to fix the found problems.
+func (gotv *GoTV) doctor(args ...string) error {
+	if len(args) > 0 {
+		return errors.New(`doctor needs no arguments`)
+	}
+
+	var r = &doctorReport{w: gotv.stdout}
+	gotv.checkRepository(r)
+	gotv.checkCachedToolchains(r)
+	gotv.checkBootstrap(r)
+	gotv.checkPath(r)
+
+	if r.problems > 0 {
+		return fmt.Errorf("%d problem(s) found", r.problems)
+	}
+	fmt.Fprintln(gotv.stdout, "No problems found.")
+	return nil
+}
+
+func (gotv *GoTV) checkRepository(r *doctorReport) {
+	var repoDir = gotv.replaceHomeDir(gotv.repositoryDir)
+	var recloneFixes = []string{
+		"rm -rf " + repoDir,
+		"gotv fetch-versions (or gotv init-repo)",
+	}
+
+	if _, err := os.Stat(gotv.repositoryDir); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			r.ok("The Go git repository is not cloned yet (it is cloned on demand).")
+		} else {
+			r.problem(nil, "Unable to access the Go git repository: %s", err)
+		}
+		return
+	}
+
+	repo, err := git.PlainOpen(gotv.repositoryDir)
+	if err == nil {
+		_, err = repo.Worktree()
+	}
+	if err != nil {
+		r.problem(recloneFixes, "The Go git repository (%s) is broken: %s", repoDir, err)
+		return
+	}
+	r.ok("The Go git repository is at %s (clone strategy: %s).", repoDir, readCloneOptions(gotv.repositoryDir))
+
+	// Object store.
+	if _, err := exec.LookPath("git"); err != nil {
+		r.ok("The git command is not found, the object store is not checked.")
+	} else if err := runGitCommand(gotv.context(), gotv.repositoryDir, nil, "fsck", "--connectivity-only", "--no-dangling", "--no-progress"); err != nil {
+		r.problem(recloneFixes, "The object store is corrupt: %s", err)
+	} else {
+		r.ok("The object store is intact.")
+	}
+
+	// Remote config.
+	cfg, err := repo.Config()
+	if err != nil {
+		r.problem(recloneFixes, "Unable to read the repository config: %s", err)
+	} else {
+		if _, ok := cfg.Remotes[git.DefaultRemoteName]; !ok {
+			// The configured repository address, or the first mirror.
+			var originURL = "URL"
+			if urls := repositoryURLs(gotv.repositoryURL, gotv.originConfig().Mirrors); len(urls) > 0 {
+				originURL = urls[0]
+			}
+			r.problem([]string{"git -C " + repoDir + " remote add origin " + originURL},
+				"The origin remote is not configured.")
+		}
+		for name, remote := range cfg.Remotes {
+			if err := remote.Validate(); err != nil {
+				r.problem([]string{"gotv remove-remote " + name, "gotv add-remote " + name + " URL"},
+					"The config of remote %s is invalid: %s", name, err)
+			} else {
+				r.ok("Remote %s: %s", name, gotv.replaceHomeDir(remote.URLs[0]))
+			}
+		}
+	}
+
+	// References.
+	refs, err := repo.References()
+	if err != nil {
+		r.problem(recloneFixes, "Unable to list the references: %s", err)
+		return
+	}
+	var numRefs int
+	var brokenRefs []string
+	refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		numRefs++
+		if repo.Storer.HasEncodedObject(ref.Hash()) != nil {
+			brokenRefs = append(brokenRefs, ref.Name().String())
+		}
+		return nil
+	})
+	if len(brokenRefs) > 0 {
+		var fixes = make([]string, 0, len(brokenRefs)+1)
+		for _, name := range brokenRefs {
+			fixes = append(fixes, "git -C "+repoDir+" update-ref -d "+name)
+		}
+		fixes = append(fixes, "gotv fetch-versions")
+		r.problem(fixes, "%d references point to missing objects.", len(brokenRefs))
+	} else {
+		r.ok("All the %d references are valid.", numRefs)
+	}
+
+	if _, err := loadRepositoryIndex(gotv.repositoryDir); err != nil {
+		r.problem([]string{"rm " + gotv.replaceHomeDir(repositoryIndexPath(gotv.repositoryDir))},
+			"Unable to build the index of the references: %s", err)
+	}
+}
+
+func (gotv *GoTV) checkCachedToolchains(r *doctorReport) {
+	entries, err := os.ReadDir(gotv.cacheDir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			r.problem(nil, "Unable to read the cache dir: %s", err)
+		}
+		return
+	}
+
+	var numToolchains int
+	for _, e := range entries {
+		var name = e.Name()
+		if !e.IsDir() {
+			continue
+		}
+		var dir = filepath.Join(gotv.cacheDir, name)
+		var removeFixes = []string{"rm -rf " + gotv.replaceHomeDir(dir)}
+		if dir == gotv.pinnedToolchainDir+"_temp" {
+			r.problem(removeFixes, "%s is left by an interrupted pinning.", name)
+			continue
+		}
+		var pinned = dir == gotv.pinnedToolchainDir
+		if !pinned && !isToolchainFolder(name) {
+			continue
+		}
+		numToolchains++
+
+		info, err := readToolchainInfo(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				r.problem(removeFixes, "%s is not completely built (%s is absent).", name, gotvInfoFile)
+			} else {
+				r.problem(removeFixes, "%s has a broken %s: %s", name, gotvInfoFile, err)
+			}
+			continue
+		}
+
+		var tv = parseGoToolchainVersion(info.Version, true)
+		switch tv.kind {
+		case kind_Tag, kind_Branch, kind_Revision, kind_Source:
+		default:
+			r.problem(removeFixes, "%s records an unexpected version %q in %s.", name, info.Version, gotvInfoFile)
+			continue
+		}
+		if tv.options.patch != "" {
+			if !isPatchHash(info.PatchHash) {
+				r.problem(removeFixes, "%s records a patched version without a valid patch hash in %s.", name, gotvInfoFile)
+				continue
+			}
+			// The patch files might be changed or removed since.
+			tv.options.patchHash = info.PatchHash
+		}
+		if tv.kind == kind_Source {
+			if _, hash := splitSourceVersion(tv.version); hash == "" {
+				r.problem(removeFixes, "%s records an unhashed source version %q in %s.", name, info.Version, gotvInfoFile)
+				continue
+			}
+		}
+		if !pinned && tv.folderName() != name {
+			r.problem(removeFixes, "%s records version %s, whose folder should be %s.", name, tv, tv.folderName())
+			continue
+		}
+
+		var goCommandPath = filepath.Join(dir, "bin", goCommandFilename(tv.options))
+		if _, err := os.Stat(goCommandPath); err != nil {
+			var fixes = []string{"gotv uncache-version " + tv.String()}
+			if pinned {
+				fixes = []string{"gotv pin-version " + tv.String()}
+			}
+			r.problem(fixes, "The go command of %s is absent: %s", name, err)
+			continue
+		}
+	}
+
+	r.ok("%d cached toolchains are checked.", numToolchains)
+}
+
+func isToolchainFolder(name string) bool {
+	for _, prefix := range []string{"tag_", "bra_", "rev_", "src_"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (gotv *GoTV) checkBootstrap(r *doctorReport) {
+	var installFix = "install Go 1.20+ and put its bin dir in PATH, or set GOROOT_BOOTSTRAP to its root dir"
+
+	var goCommandPath string
+	if bootstrapRoot := os.Getenv("GOROOT_BOOTSTRAP"); bootstrapRoot != "" {
+		goCommandPath = filepath.Join(bootstrapRoot, "bin", goCommandFilename(buildOptions{}))
+		if _, err := os.Stat(goCommandPath); err != nil {
+			r.problem([]string{installFix}, "GOROOT_BOOTSTRAP (%s) is not a Go installation: %s", bootstrapRoot, err)
+			return
+		}
+	} else {
+		var err error
+		if goCommandPath, err = exec.LookPath("go"); err != nil {
+			r.problem([]string{installFix}, "No bootstrap toolchain is found to build toolchains: %s", err)
+			return
+		}
+	}
+
+	output, err := exec.CommandContext(gotv.context(), goCommandPath, "version").Output()
+	if err != nil {
+		r.problem([]string{installFix}, "The bootstrap toolchain (%s) doesn't work: %s", gotv.replaceHomeDir(goCommandPath), err)
+		return
+	}
+	r.ok("Bootstrap toolchain: %s (%s)", gotv.replaceHomeDir(goCommandPath), strings.TrimSpace(string(output)))
+}
+
+func (gotv *GoTV) checkPath(r *doctorReport) {
+	var pathDirs = filepath.SplitList(os.Getenv("PATH"))
+	var inPath = func(dir string) bool {
+		for _, d := range pathDirs {
+			if filepath.Clean(d) == filepath.Clean(dir) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if exePath, err := os.Executable(); err == nil {
+		if _, err := exec.LookPath("gotv"); err != nil {
+			r.problem([]string{"add " + gotv.replaceHomeDir(filepath.Dir(exePath)) + " to PATH"},
+				"The gotv command is not in PATH.")
+		}
+	}
+
+	if _, err := os.Stat(gotv.pinnedToolchainDir); err != nil {
+		r.ok("No version is pinned.")
+		return
+	}
+
+	var pinnedBinDir = filepath.Join(gotv.pinnedToolchainDir, "bin")
+	var pathFix = "add " + gotv.replaceHomeDir(pinnedBinDir) + " to the front of PATH"
+	if !inPath(pinnedBinDir) {
+		r.problem([]string{pathFix}, "The pinned toolchain is not in PATH.")
+		return
+	}
+
+	goCommandPath, err := exec.LookPath("go")
+	if err == nil && filepath.Dir(goCommandPath) != filepath.Clean(pinnedBinDir) {
+		r.problem([]string{pathFix}, "The go command in PATH is %s, which shadows the pinned toolchain.", gotv.replaceHomeDir(goCommandPath))
+		return
+	}
+	r.ok("The pinned toolchain is in PATH (%s).", gotv.replaceHomeDir(pinnedBinDir))
+}
@@ -0,0 +1,78 @@
+package toolchain
+
+import (
+	"fmt"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+)
+
+// expandFetchRefSpec converts a ref pattern to a full refspec
+// for the origin remote. Full refspecs are kept as they are.
+//
+//	refs/tags/go*     => +refs/tags/go*:refs/tags/go*
+//	refs/heads/dev.*  => +refs/heads/dev.*:refs/remotes/origin/dev.*
+//	release-branch.*  => +refs/heads/release-branch.*:refs/remotes/origin/release-branch.*
+func expandFetchRefSpec(spec string) (string, error) {
+	if !strings.Contains(spec, ":") {
+		const BranchRefPrefix = "refs/heads/"
+		switch {
+		case strings.HasPrefix(spec, "refs/tags/"):
+			spec = "+" + spec + ":" + spec
+		case strings.HasPrefix(spec, BranchRefPrefix):
+			spec = "+" + spec + ":refs/remotes/" + git.DefaultRemoteName + "/" + spec[len(BranchRefPrefix):]
+		case strings.HasPrefix(spec, "refs/"):
+			return "", fmt.Errorf("invalid refspec %s: only tags and branches are fetched", spec)
+		default:
+			spec = "+" + BranchRefPrefix + spec + ":refs/remotes/" + git.DefaultRemoteName + "/" + spec
+		}
+	}
+
+	var refSpec = gitconfig.RefSpec(spec)
+	if err := refSpec.Validate(); err != nil {
+		return "", fmt.Errorf("invalid refspec %s: %w", spec, err)
+	}
+	if refSpec.IsDelete() {
+		return "", fmt.Errorf("invalid refspec %s: delete refspecs are not allowed", spec)
+	}
+	return spec, nil
+}
+
+func (gotv *GoTV) setFetchRefSpecs(args ...string) error {
+	config, err := gotv.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if len(config.FetchRefSpecs) == 0 {
+			fmt.Fprintln(gotv.stdout, "The refspecs in the remote config are used to fetch origin.")
+		} else {
+			fmt.Fprintln(gotv.stdout, "Fetch refspecs of origin:")
+			for _, spec := range config.FetchRefSpecs {
+				fmt.Fprintf(gotv.stdout, "\t%s\n", spec)
+			}
+		}
+		return nil
+	}
+
+	if len(args) == 1 && args[0] == "-default" {
+		config.FetchRefSpecs = nil
+		fmt.Fprintln(gotv.stdout, "The refspecs in the remote config will be used to fetch origin.")
+		return gotv.saveConfig(config)
+	}
+
+	var specs = make([]string, len(args))
+	for i, arg := range args {
+		if specs[i], err = expandFetchRefSpec(arg); err != nil {
+			return err
+		}
+	}
+	config.FetchRefSpecs = specs
+	fmt.Fprintln(gotv.stdout, "Fetch refspecs of origin are set as:")
+	for _, spec := range specs {
+		fmt.Fprintf(gotv.stdout, "\t%s\n", spec)
+	}
+	return gotv.saveConfig(config)
+}
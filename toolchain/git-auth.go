@@ -0,0 +1,253 @@
+package toolchain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// gitHTTPAuth returns the authentication for an HTTP(S) repository
+// address. The credentials are looked up in the following order:
+//
+//   - the user info in the address (used by go-git directly),
+//   - the GOTV_GIT_USERNAME and GOTV_GIT_PASSWORD (basic auth), or
+//     GOTV_GIT_TOKEN (bearer token auth) environment variables, which
+//     are only used for the host of gitCredentialsHost(originAddr),
+//   - the netrc file ($NETRC, or ~/.netrc).
+//
+// It returns nil if no credentials are found. The git credential
+// helpers are only asked after the server requires authentication
+// (see retryWithCredentialHelper).
+func gitHTTPAuth(repoAddr, originAddr string) (gittransport.AuthMethod, error) {
+	u, err := url.Parse(repoAddr)
+	if err != nil {
+		return nil, err
+	}
+	if u.User != nil {
+		return nil, nil
+	}
+
+	if strings.EqualFold(u.Hostname(), gitCredentialsHost(originAddr)) {
+		if password := os.Getenv("GOTV_GIT_PASSWORD"); password != "" {
+			var username = os.Getenv("GOTV_GIT_USERNAME")
+			if username == "" {
+				username = "git" // the user name doesn't matter for most token servers
+			}
+			return &githttp.BasicAuth{Username: username, Password: password}, nil
+		}
+		if token := os.Getenv("GOTV_GIT_TOKEN"); token != "" {
+			return &githttp.TokenAuth{Token: token}, nil
+		}
+	}
+
+	if login, password, ok := netrcCredentials(u.Hostname()); ok {
+		return &githttp.BasicAuth{Username: login, Password: password}, nil
+	}
+
+	return nil, nil
+}
+
+// gitCredentialsHost returns the only host which the credentials in the
+// GOTV_GIT_* environment variables are sent to: the one specified by
+// GOTV_GIT_HOST, or the host of the origin address.
+func gitCredentialsHost(originAddr string) string {
+	if host := os.Getenv("GOTV_GIT_HOST"); host != "" {
+		return host
+	}
+	u, err := url.Parse(originAddr)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// retryWithCredentialHelper calls f with auth. If f fails because an
+// HTTP(S) server requires authentication, f is called again with the
+// credentials from the git credential helpers (if any). The auth used
+// by the last call is returned.
+func retryWithCredentialHelper(repoAddr string, auth gittransport.AuthMethod, f func(gittransport.AuthMethod) error) (gittransport.AuthMethod, error) {
+	var err = f(auth)
+	if err != gittransport.ErrAuthenticationRequired {
+		return auth, err
+	}
+	u, parseErr := url.Parse(repoAddr)
+	if parseErr != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return auth, err
+	}
+	username, password, ok := gitCredentialHelper(u)
+	if !ok {
+		return auth, err
+	}
+	auth = &githttp.BasicAuth{Username: username, Password: password}
+	return auth, f(auth)
+}
+
+func netrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(homeDir, "_netrc")
+	}
+	return filepath.Join(homeDir, ".netrc")
+}
+
+// netrcCredentials looks up the login and password of a host
+// in the netrc file. The default entry is used if the host
+// is not listed.
+func netrcCredentials(host string) (login, password string, ok bool) {
+	var path = netrcPath()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	return parseNetrc(data, host)
+}
+
+func parseNetrc(data []byte, host string) (login, password string, ok bool) {
+	type entry struct {
+		login, password string
+	}
+	var matched, fallback *entry
+	var current *entry
+	var isMatched, isDefault bool
+	var finishEntry = func() {
+		if current == nil {
+			return
+		}
+		if isMatched && matched == nil {
+			matched = current
+		} else if isDefault && fallback == nil {
+			fallback = current
+		}
+		current = nil
+	}
+
+	var fields = strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			finishEntry()
+			current = &entry{}
+			isDefault = false
+			isMatched = i+1 < len(fields) && fields[i+1] == host
+			i++
+		case "default":
+			finishEntry()
+			current = &entry{}
+			isDefault, isMatched = true, false
+		case "login":
+			if current != nil && i+1 < len(fields) {
+				current.login = fields[i+1]
+			}
+			i++
+		case "password":
+			if current != nil && i+1 < len(fields) {
+				current.password = fields[i+1]
+			}
+			i++
+		case "account":
+			i++
+		case "macdef":
+			// Macros end at blank lines, which are not distinguished
+			// by strings.Fields. Macros are rarely used, so the rest
+			// of the file is ignored.
+			finishEntry()
+			i = len(fields)
+		}
+	}
+	finishEntry()
+
+	if matched == nil {
+		matched = fallback
+	}
+	if matched == nil || matched.password == "" {
+		return "", "", false
+	}
+	return matched.login, matched.password, true
+}
+
+// gitCredentialHelper asks the git credential helpers configured
+// by the user for the credentials of a repository. The user is
+// never prompted. It fails if the git command is not found.
+func gitCredentialHelper(u *url.URL) (username, password string, ok bool) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return
+	}
+
+	var input = fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	var cmd = exec.CommandContext(ctx, gitPath, "credential", "fill")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	output, err := cmd.Output()
+	if err != nil {
+		return
+	}
+
+	var scanner = bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		var line = scanner.Text()
+		if i := strings.IndexByte(line, '='); i > 0 {
+			switch line[:i] {
+			case "username":
+				username = line[i+1:]
+			case "password":
+				password = line[i+1:]
+			}
+		}
+	}
+	return username, password, password != ""
+}
+
+// gitCABundle returns the content of the PEM file specified by
+// GOTV_GIT_CA_BUNDLE (or GIT_SSL_CAINFO), whose CA certificates are
+// trusted besides the system ones when accessing HTTPS repositories.
+// It is passed to go-git in the options of each call, instead of
+// replacing the HTTP(S) transport of go-git for the whole process.
+//
+// The proxies specified by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables are used by the default HTTP(S) transport of
+// go-git. The one created by go-git for a CA bundle doesn't use them.
+func gitCABundle() ([]byte, error) {
+	var bundle = os.Getenv("GOTV_GIT_CA_BUNDLE")
+	if bundle == "" {
+		bundle = os.Getenv("GIT_SSL_CAINFO")
+	}
+	if bundle == "" {
+		return nil, nil
+	}
+	return loadCABundle(bundle)
+}
+
+func loadCABundle(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read CA bundle: %w", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates are found in CA bundle %s", path)
+	}
+	return data, nil
+}
@@ -0,0 +1,652 @@
+package toolchain
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	//"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"golang.org/x/crypto/ssh"
+	//gitobject "github.com/go-git/go-git/v5/plumbing/object"
+	gitconfig "github.com/go-git/go-git/v5/config"
+)
+
+// gitAuth returns the authentication for a repository address.
+// originAddr is the address of the origin remote, whose host is
+// the default one the credentials in environment variables are
+// sent to (see gitHTTPAuth). The ssh key file (and its passphrase)
+// of an ssh address is asked from input, which may be nil.
+func gitAuth(repoAddr, originAddr string, input *userInput) (gittransport.AuthMethod, error) {
+	var isSshProtocol bool
+	for {
+		addr := strings.ToLower(repoAddr)
+		if strings.HasPrefix(addr, "https://") || strings.HasPrefix(addr, "http://") {
+			return gitHTTPAuth(repoAddr, originAddr)
+		}
+		isSshProtocol = strings.HasPrefix(addr, "ssh://")
+		if isSshProtocol {
+			break
+		}
+		if i := strings.IndexByte(addr, '@'); i >= 0 {
+			// also check ':' ?
+			isSshProtocol = true
+			break
+		}
+		break
+	}
+
+	if isSshProtocol {
+		var homeDir, err = os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		var potentialKeys = make([]string, 0, 2)
+		sshPath := filepath.Join(homeDir, ".ssh")
+		files, err := os.ReadDir(sshPath)
+		if err == nil {
+			for _, f := range files {
+				if f.IsDir() {
+					continue
+				}
+				name := f.Name()
+				if strings.HasPrefix(name, "id_") && !strings.HasSuffix(name, ".pub") {
+					potentialKeys = append(potentialKeys, filepath.Join(sshPath, name))
+				}
+			}
+		}
+
+		var sshKeyFilePath string
+		switch len(potentialKeys) {
+		case 0:
+			input.println()
+			input.println(`Need a ssh key to authenticate to remote server.`)
+			for sshKeyFilePath == "" {
+				if sshKeyFilePath, err = input.ask(`Specify the key file here: `); err != nil {
+					return nil, err
+				}
+			}
+
+		case 1:
+			if input == nil {
+				// No way to ask, so use the only key.
+				sshKeyFilePath = potentialKeys[0]
+				break
+			}
+			input.println()
+			sshKeyFilePath, err = input.ask(fmt.Sprintf(`Need a ssh key to authenticate to remote server.
+Specify the key file here (Enter for %s): `, potentialKeys[0]))
+			if err != nil {
+				return nil, err
+			}
+			if sshKeyFilePath == "" {
+				sshKeyFilePath = potentialKeys[0]
+			}
+
+		case 2:
+			input.println()
+			input.println(`Need a ssh key to authenticate to remote server.
+The key file might be one of (but not limited to) the following ones:`)
+			for _, f := range potentialKeys {
+				input.println("* " + f)
+			}
+
+			input.println()
+			for sshKeyFilePath == "" {
+				if sshKeyFilePath, err = input.ask(`Specify the key file here: `); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		sshKey, err := os.ReadFile(sshKeyFilePath)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey([]byte(sshKey))
+		if err != nil {
+			if _, ok := err.(*ssh.PassphraseMissingError); !ok {
+				return nil, err
+			}
+			passphase, err := input.ask(`Passphase: `)
+			if err != nil {
+				return nil, err
+			}
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(sshKey), []byte(passphase))
+			if err != nil {
+				return nil, err
+			}
+		}
+		//hostKeyCallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		//	return nil
+		//}
+
+		return &gitssh.PublicKeys{
+			User:   "git",
+			Signer: signer,
+
+			// Since go-git v5.5.0, this field is gone.
+			//HostKeyCallbackHelper: gitssh.HostKeyCallbackHelper{
+			//	HostKeyCallback: hostKeyCallback,
+			//},
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// errNoUserInput is returned when the user needs to be asked,
+// but there is no interactive input (see Options.Stdin).
+var errNoUserInput = errors.New("user input is needed, but there is no interactive input")
+
+// userInput asks the user for the information which is needed to
+// access repositories, such as ssh key files. The prompts are written
+// to out. A nil *userInput means there is no interactive input.
+type userInput struct {
+	in  io.Reader
+	out io.Writer
+}
+
+func (ui *userInput) println(a ...interface{}) {
+	if ui != nil {
+		fmt.Fprintln(ui.out, a...)
+	}
+}
+
+// ask writes the prompt and returns the next input line, which is
+// trimmed. The input is read byte by byte, so that no bytes after
+// the line are consumed.
+func (ui *userInput) ask(prompt string) (string, error) {
+	if ui == nil {
+		return "", errNoUserInput
+	}
+	fmt.Fprint(ui.out, prompt)
+
+	var line []byte
+	var b = make([]byte, 1)
+	for {
+		n, err := ui.in.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(string(line)), nil
+}
+
+func gitClone(ctx context.Context, repoAddr string, auth gittransport.AuthMethod, toDir string, opts cloneOptions, report func(Event)) (err error) {
+	var finish = startPhase(report, PhaseClone, "", repoAddr)
+	defer func() {
+		finish(dirSize(filepath.Join(toDir, ".git", "objects")), err)
+	}()
+
+	var progress = newGitProgressWriter(report, PhaseClone)
+	defer progress.Flush()
+	if opts.isPartial() || opts.Strategy == cloneStrategy_Blobless {
+		return gitCloneWithOptions(ctx, repoAddr, toDir, opts, auth, progress)
+	}
+	caBundle, err := gitCABundle()
+	if err != nil {
+		return err
+	}
+	_, err = git.PlainCloneContext(ctx, toDir, false,
+		&git.CloneOptions{
+			Auth:     auth,
+			URL:      repoAddr,
+			Progress: progress,
+			CABundle: caBundle,
+		},
+	)
+	return err
+}
+
+// gitFetch fetches all the remotes and prunes the references which
+// don't exist in the remotes any more. The origin remote is fetched
+// with the origin config. It returns git.NoErrAlreadyUpToDate only
+// if all the remotes are up to date.
+func gitFetch(ctx context.Context, repoDir string, origin originConfig, report func(Event), input *userInput) (pruned []string, err error) {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return nil, err
+	}
+
+	var upToDate = true
+	for _, remote := range remotes {
+		var name = remote.Config().Name
+		var config originConfig
+		if name == git.DefaultRemoteName {
+			config = origin
+		}
+		removed, err := gitFetchRemote(ctx, repoDir, repo, name, config, report, input)
+		pruned = append(pruned, removed...)
+		if err != nil {
+			if err != git.NoErrAlreadyUpToDate {
+				return pruned, fmt.Errorf("fetch %s: %w", name, err)
+			}
+		} else {
+			upToDate = false
+		}
+	}
+
+	if upToDate {
+		return pruned, git.NoErrAlreadyUpToDate
+	}
+	return pruned, nil
+}
+
+// Tags are only fetched from the origin remote, so that
+// the tags in other remotes never shadow the official ones.
+//
+// If config.RefSpecs is blank, the refspecs in the remote config are
+// used. The references fetched by the used refspecs are pruned if
+// they don't exist in the remote any more. The names of the pruned
+// references are returned. If the remote URL fails, the mirrors in the config
+// are tried in order.
+func gitFetchRemote(ctx context.Context, repoDir string, repo *git.Repository, remoteName string, config originConfig, report func(Event), input *userInput) (pruned []string, err error) {
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return nil, err
+	}
+	var remoteURL = remote.Config().URLs[0]
+
+	// Partial clones are fetched by the git command.
+	var useCommand = isPromisorRemote(repo, remoteName)
+
+	var objectsDir = filepath.Join(repoDir, ".git", "objects")
+	var oldSize = dirSize(objectsDir)
+	var finish = startPhase(report, PhaseFetch, "", remoteName)
+	defer func() {
+		if err == git.NoErrAlreadyUpToDate {
+			finish(0, nil)
+		} else {
+			finish(dirSize(objectsDir)-oldSize, err)
+		}
+	}()
+
+	// The refspecs used by the fetch, and so the pruning.
+	var refSpecs []gitconfig.RefSpec
+	for _, spec := range config.RefSpecs {
+		refSpecs = append(refSpecs, gitconfig.RefSpec(spec))
+	}
+	if len(refSpecs) == 0 {
+		refSpecs = remote.Config().Fetch
+	}
+
+	var oldRefs map[plumbing.ReferenceName]bool
+	if useCommand {
+		if oldRefs, err = gitReferenceNames(repo); err != nil {
+			return nil, err
+		}
+	}
+
+	// The local references of the remote references matched by the
+	// refspecs in the last fetch of go-git.
+	var fetchedRefs map[plumbing.ReferenceName]bool
+	var fetch = func(ctx context.Context, repoAddr string, auth gittransport.AuthMethod, report func(Event)) error {
+		var progress = newGitProgressWriter(report, PhaseFetch)
+		defer progress.Flush()
+		if useCommand {
+			var args = []string{"fetch", "--progress", "--prune"}
+			if repoAddr != remoteURL {
+				// Fetch the mirror as the remote, so that the
+				// remote config (such as the filter) is used.
+				args = append([]string{"-c", "url." + repoAddr + ".insteadOf=" + remoteURL}, args...)
+			}
+			if remoteName != git.DefaultRemoteName {
+				args = append(args, "--no-tags")
+			}
+			args = append(args, remoteName)
+			return runGitCommand(ctx, repoDir, progress, append(args, config.RefSpecs...)...)
+		}
+
+		caBundle, err := gitCABundle()
+		if err != nil {
+			return err
+		}
+		var o = git.FetchOptions{
+			RemoteName: remoteName,
+			Auth:       auth,
+			Progress:   progress,
+			Force:      true,
+			CABundle:   caBundle,
+			RefSpecs:   refSpecs,
+		}
+		if repoAddr != remoteURL {
+			o.RemoteURL = repoAddr
+		}
+		if remoteName != git.DefaultRemoteName {
+			o.Tags = git.NoTags
+		}
+		storage, ok := repo.Storer.(*filesystem.Storage)
+		if !ok {
+			return fmt.Errorf("unsupported repository storage %T", repo.Storer)
+		}
+		var recorder = &refRecordingStorage{Storage: storage, names: map[plumbing.ReferenceName]bool{}}
+		err = git.NewRemote(recorder, remote.Config()).FetchContext(ctx, &o)
+		// go-git reports this error instead of NoErrAlreadyUpToDate
+		// when a shallow repository has nothing new to fetch. The
+		// local references are not looked up in this case.
+		if err == gittransport.ErrEmptyUploadPackRequest {
+			return git.NoErrAlreadyUpToDate
+		}
+		if err == nil || err == git.NoErrAlreadyUpToDate {
+			fetchedRefs = recorder.names
+		}
+		return err
+	}
+	var originURL = remoteURL
+	if remoteName != git.DefaultRemoteName {
+		if origin, err := repo.Remote(git.DefaultRemoteName); err == nil {
+			originURL = origin.Config().URLs[0]
+		} else {
+			originURL = ""
+		}
+	}
+	var urls = repositoryURLs(remoteURL, config.Mirrors)
+	_, _, err = tryRepositoryURLs(ctx, urls, originURL, config.Timeout, filepath.Join(objectsDir, "pack"), report, input, fetch)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, err
+	}
+
+	var pruneErr error
+	if useCommand {
+		pruned, pruneErr = gitRemovedReferences(repo, oldRefs)
+	} else if fetchedRefs != nil {
+		pruned, pruneErr = gitPruneReferences(repo, refSpecs, fetchedRefs)
+	}
+	if pruneErr != nil {
+		return pruned, pruneErr
+	}
+	if len(pruned) > 0 && err == git.NoErrAlreadyUpToDate {
+		err = nil
+	}
+	return pruned, err
+}
+
+// refRecordingStorage records the names of the references looked up
+// through it. After a fetch, go-git looks up the local reference of
+// every remote reference matched by the refspecs, so the recorded
+// names are the local references which still exist in the remote.
+// go-git doesn't support pruning in fetching, and this avoids listing
+// the remote references again for pruning.
+type refRecordingStorage struct {
+	*filesystem.Storage
+	names map[plumbing.ReferenceName]bool
+}
+
+func (s *refRecordingStorage) Reference(name plumbing.ReferenceName) (*plumbing.Reference, error) {
+	s.names[name] = true
+	return s.Storage.Reference(name)
+}
+
+// gitPruneReferences removes the local references fetched by some
+// refspecs if they are not in fetchedRefs (see refRecordingStorage),
+// just like "git fetch --prune" does. The names of the removed
+// references are returned.
+func gitPruneReferences(repo *git.Repository, refSpecs []gitconfig.RefSpec, fetchedRefs map[plumbing.ReferenceName]bool) (pruned []string, err error) {
+	iter, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	var stale []plumbing.ReferenceName
+	iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || fetchedRefs[ref.Name()] {
+			return nil
+		}
+		for _, spec := range refSpecs {
+			if spec.IsDelete() || spec.IsExactSHA1() {
+				continue
+			}
+			// Reverse keeps the force flag, which must be removed.
+			var reversed = gitconfig.RefSpec(strings.TrimPrefix(string(spec), "+")).Reverse()
+			if reversed.Match(ref.Name()) {
+				stale = append(stale, ref.Name())
+				break
+			}
+		}
+		return nil
+	})
+
+	for _, name := range stale {
+		if err := repo.Storer.RemoveReference(name); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, name.Short())
+	}
+	return pruned, nil
+}
+
+// gitReferenceNames returns the names of the local references.
+func gitReferenceNames(repo *git.Repository) (map[plumbing.ReferenceName]bool, error) {
+	iter, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	var names = map[plumbing.ReferenceName]bool{}
+	iter.ForEach(func(ref *plumbing.Reference) error {
+		names[ref.Name()] = true
+		return nil
+	})
+	return names, nil
+}
+
+// gitRemovedReferences returns the names of the references
+// in oldRefs which have been removed (by "git fetch --prune").
+func gitRemovedReferences(repo *git.Repository, oldRefs map[plumbing.ReferenceName]bool) (removed []string, err error) {
+	refs, err := gitReferenceNames(repo)
+	if err != nil {
+		return nil, err
+	}
+	for name := range oldRefs {
+		if !refs[name] {
+			removed = append(removed, name.Short())
+		}
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
+
+func gitAddRemote(ctx context.Context, repoDir, remoteName, repoAddr string, report func(Event), input *userInput) error {
+	var repo, err = git.PlainOpen(repoDir)
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.CreateRemote(&gitconfig.RemoteConfig{
+		Name: remoteName,
+		URLs: []string{repoAddr},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = gitFetchRemote(ctx, repoDir, repo, remoteName, originConfig{}, report, input)
+	if err == git.NoErrAlreadyUpToDate {
+		err = nil
+	}
+	return err
+}
+
+// gitRemoveRemote removes a remote and its remote-tracking branches.
+func gitRemoveRemote(repoDir, remoteName string) error {
+	var repo, err = git.PlainOpen(repoDir)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.DeleteRemote(remoteName); err != nil {
+		return err
+	}
+
+	iter, err := repo.References()
+	if err != nil {
+		return err
+	}
+
+	var prefix = "refs/remotes/" + remoteName + "/"
+	var refNames []plumbing.ReferenceName
+	iter.ForEach(func(ref *plumbing.Reference) error {
+		if strings.HasPrefix(string(ref.Name()), prefix) {
+			refNames = append(refNames, ref.Name())
+		}
+		return nil
+	})
+
+	for _, name := range refNames {
+		if err := repo.Storer.RemoveReference(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gitListRemotes returns the URLs of remotes, keyed by remote names.
+func gitListRemotes(repoDir string) (map[string]string, error) {
+	var repo, err = git.PlainOpen(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return nil, err
+	}
+
+	var urls = make(map[string]string, len(remotes))
+	for _, remote := range remotes {
+		var c = remote.Config()
+		urls[c.Name] = strings.Join(c.URLs, " ")
+	}
+	return urls, nil
+}
+
+// gitRemoteBranchReference returns the reference name of a branch
+// listed by gitListTagsAndRemoteBranches.
+func gitRemoteBranchReference(repoDir, branch string) (plumbing.ReferenceName, error) {
+	var repo, err = git.PlainOpen(repoDir)
+	if err != nil {
+		return "", err
+	}
+
+	var name = plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch)
+	if _, err := repo.Reference(name, false); err == nil {
+		return name, nil
+	}
+	name = plumbing.ReferenceName("refs/remotes/" + branch)
+	if _, err := repo.Reference(name, false); err != nil {
+		return "", fmt.Errorf("branch %s: %w", branch, err)
+	}
+	return name, nil
+}
+
+func gitWorktree(repoDir string) (*git.Worktree, error) {
+	var repo, err = git.PlainOpen(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	return repo.Worktree()
+}
+
+func gitCheckout(repoDir string, opt *git.CheckoutOptions) error {
+	worktree, err := gitWorktree(repoDir)
+	if err != nil {
+		return err
+	}
+
+	return worktree.Checkout(opt)
+}
+
+func gitListTagsAndRemoteBranches(repoDir string) (tags map[string]string, bras map[string]string, err error) {
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		return
+	}
+
+	iter, err := repo.References()
+	if err != nil {
+		return
+	}
+
+	const TagRefPrefix = "refs/tags/"
+	const BranchRefPrefix = "refs/remotes/origin/"
+	const RemoteRefPrefix = "refs/remotes/"
+
+	// Branches in other remotes are named as REMOTE/BRANCH.
+	// Branches in origin win if there are name conflicts.
+	var otherBras = make(map[string]string, 32)
+
+	tags = make(map[string]string, 1024)
+	bras = make(map[string]string, 128)
+	iter.ForEach(func(ref *plumbing.Reference) error {
+		switch name := string(ref.Name()); {
+		case strings.HasPrefix(name, TagRefPrefix):
+			var hash = ref.Hash()
+			tags[name[len(TagRefPrefix):]] = hex.EncodeToString(hash[:])
+		case strings.HasPrefix(name, BranchRefPrefix):
+			var hash = ref.Hash()
+			bras[name[len(BranchRefPrefix):]] = hex.EncodeToString(hash[:])
+		case strings.HasPrefix(name, RemoteRefPrefix):
+			if ref.Type() == plumbing.HashReference {
+				var hash = ref.Hash()
+				otherBras[name[len(RemoteRefPrefix):]] = hex.EncodeToString(hash[:])
+			}
+		default:
+			//fmt.Println(ref.String())
+		}
+		return nil
+	})
+
+	for bra, hash := range otherBras {
+		if _, ok := bras[bra]; !ok {
+			bras[bra] = hash
+		}
+	}
+
+	return
+}
+
+// gitTagDates returns the dates of tags (keyed by tag names), which
+// are the tagger dates of annotated tags, or the committer dates of
+// the tagged commits of lightweight tags.
+func gitTagDates(repoDir string, tags map[string]string) (map[string]time.Time, error) {
+	var repo, err = git.PlainOpen(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var dates = make(map[string]time.Time, len(tags))
+	for tag, hash := range tags {
+		var h = plumbing.NewHash(hash)
+		if tagObj, err := repo.TagObject(h); err == nil {
+			dates[tag] = tagObj.Tagger.When
+		} else if commit, err := repo.CommitObject(h); err == nil {
+			dates[tag] = commit.Committer.When
+		}
+	}
+	return dates, nil
+}
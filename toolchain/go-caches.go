@@ -0,0 +1,159 @@
+package toolchain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go101.org/gotv/internal/util"
+)
+
+// The policies of the GOCACHE and GOMODCACHE directories used by
+// the go commands run through gotv. They are specified by the
+// -gocache: and -gomodcache: options, or by the default-caches
+// command.
+const (
+	// Use the caches of the user (GOCACHE and GOMODCACHE are not set).
+	cachePolicy_Shared = "shared"
+	// All toolchains use the same cache in the gotv cache dir.
+	cachePolicy_GoTV = "gotv"
+	// Each toolchain uses its own cache in the gotv cache dir.
+	cachePolicy_Isolated = "isolated"
+)
+
+func isValidCachePolicy(policy string) bool {
+	switch policy {
+	case cachePolicy_Shared, cachePolicy_GoTV, cachePolicy_Isolated:
+		return true
+	}
+	return false
+}
+
+func (gotv *GoTV) goCachesDir() string {
+	return filepath.Join(gotv.cacheDir, "go-caches")
+}
+
+// goCachesEnvs returns the GOCACHE and GOMODCACHE settings for
+// running go commands of a (normalized) version. The policies
+// specified in the command line take precedence over the
+// default ones.
+func (gotv *GoTV) goCachesEnvs(tv toolchainVersion, opts goCommandOptions) ([]string, error) {
+	config, err := gotv.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var gocache, gomodcache = opts.gocache, opts.gomodcache
+	if gocache == "" {
+		gocache = config.GoCachePolicy
+	}
+	if gomodcache == "" {
+		gomodcache = config.GoModCachePolicy
+	}
+
+	var envs []string
+	var cacheDir = func(policy, name string) string {
+		if policy == cachePolicy_Isolated {
+			return filepath.Join(gotv.goCachesDir(), tv.folderName(), name)
+		}
+		return filepath.Join(gotv.goCachesDir(), name)
+	}
+	if gocache != "" && gocache != cachePolicy_Shared {
+		envs = append(envs, "GOCACHE="+cacheDir(gocache, "go-build"))
+	}
+	if gomodcache != "" && gomodcache != cachePolicy_Shared {
+		envs = append(envs, "GOMODCACHE="+cacheDir(gomodcache, "mod"))
+	}
+	return envs, nil
+}
+
+func (gotv *GoTV) setDefaultCaches(args ...string) error {
+	var flags = newFlagSet("default-caches")
+	var gocache = flags.String("gocache", "", "")
+	var gomodcache = flags.String("gomodcache", "", "")
+	if rest, err := parseFlags(flags, args); err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return errors.New(`default-caches needs no non-option arguments`)
+	}
+
+	config, err := gotv.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range []struct {
+		name, policy string
+		setting      *string
+	}{
+		{"GOCACHE", *gocache, &config.GoCachePolicy},
+		{"GOMODCACHE", *gomodcache, &config.GoModCachePolicy},
+	} {
+		if p.policy == "" {
+			if *p.setting == "" {
+				fmt.Fprintf(gotv.stdout, "%s policy: %s\n", p.name, cachePolicy_Shared)
+			} else {
+				fmt.Fprintf(gotv.stdout, "%s policy: %s\n", p.name, *p.setting)
+			}
+			continue
+		}
+		if !isValidCachePolicy(p.policy) {
+			return fmt.Errorf("invalid %s policy: %s (should be one of shared, gotv and isolated)", p.name, p.policy)
+		}
+		if p.policy == cachePolicy_Shared {
+			*p.setting = ""
+		} else {
+			*p.setting = p.policy
+		}
+		fmt.Fprintf(gotv.stdout, "%s policy is set as %s now.\n", p.name, p.policy)
+	}
+
+	if *gocache == "" && *gomodcache == "" {
+		return nil
+	}
+	return gotv.saveConfig(config)
+}
+
+// cleanGoCaches removes the GOCACHE and GOMODCACHE directories
+// in the gotv cache dir, either all of them or the isolated ones
+// of the specified versions.
+func (gotv *GoTV) cleanGoCaches(versions ...string) error {
+	if len(versions) == 0 {
+		return gotv.removeGoCachesDir(gotv.goCachesDir())
+	}
+
+	tvs, err := parseGoToolchainVersions(versions...)
+	if err != nil {
+		return err
+	}
+	if clearForceSyncRepoFrromVersions(tvs) {
+		fmt.Fprintln(gotv.stdout, "The ! sign is ignored.")
+	}
+
+	if gotv.repoInfo, err = gotv.loadRepositoryInfo(false); err != nil {
+		return err
+	}
+
+	for i := range tvs {
+		if err := gotv.normalizeToolchainVersion(&tvs[i], false); err != nil {
+			return err
+		}
+		if err := gotv.removeGoCachesDir(filepath.Join(gotv.goCachesDir(), tvs[i].folderName())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gotv *GoTV) removeGoCachesDir(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	fmt.Fprintln(gotv.stdout, "[Run]: rm -rf", gotv.replaceHomeDir(dir))
+	return util.ForceRemoveAll(dir)
+}
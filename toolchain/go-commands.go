@@ -0,0 +1,732 @@
+package toolchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"go101.org/gotv/internal/util"
+)
+
+// goCommandOptions are the gotv options specified between
+// the toolchain version and the go arguments, such as
+//
+//	gotv 1.21 -env:CGO_ENABLED=1 -env:GOFLAGS=-mod=mod build
+type goCommandOptions struct {
+	envs []string // NAME=VALUE items
+
+	// The policies for GOCACHE and GOMODCACHE (see go-caches.go).
+	gocache, gomodcache string
+}
+
+const (
+	envOptionPrefix        = "-env:"
+	gocacheOptionPrefix    = "-gocache:"
+	gomodcacheOptionPrefix = "-gomodcache:"
+)
+
+func isGoCommandOption(arg string) bool {
+	return strings.HasPrefix(arg, envOptionPrefix) ||
+		strings.HasPrefix(arg, gocacheOptionPrefix) ||
+		strings.HasPrefix(arg, gomodcacheOptionPrefix)
+}
+
+// parseGoCommandOptions parses the leading gotv options in args
+// and returns the remaining go arguments.
+func parseGoCommandOptions(args []string) (opts goCommandOptions, goArgs []string, err error) {
+	for i, arg := range args {
+		if !isGoCommandOption(arg) {
+			return opts, args[i:], nil
+		}
+
+		var policy *string
+		switch {
+		case strings.HasPrefix(arg, gocacheOptionPrefix):
+			policy = &opts.gocache
+		case strings.HasPrefix(arg, gomodcacheOptionPrefix):
+			policy = &opts.gomodcache
+		}
+		if policy != nil {
+			*policy = arg[strings.IndexByte(arg, ':')+1:]
+			if !isValidCachePolicy(*policy) {
+				err = fmt.Errorf("invalid option %s (the policy should be one of shared, gotv and isolated)", arg)
+				return
+			}
+			continue
+		}
+
+		var env = arg[len(envOptionPrefix):]
+		if !isValidEnvSetting(env) {
+			err = fmt.Errorf("invalid option %s (should be in the form of %sNAME=VALUE)", arg, envOptionPrefix)
+			return
+		}
+		opts.envs = append(opts.envs, env)
+	}
+
+	return opts, nil, nil
+}
+
+func isValidEnvSetting(env string) bool {
+	return strings.IndexByte(env, '=') > 0
+}
+
+func (gotv *GoTV) tryRunningGoToolchainCommand(tv toolchainVersion, opts goCommandOptions, args []string) error {
+	if tv.options.isCrossCompiled() {
+		return fmt.Errorf("toolchain %s is built for %s, it can't run on this host", tv, tv.options.target())
+	}
+
+	var specified = tv
+	if _, err := gotv.ensureToolchainVersion(&tv, false); err != nil {
+		return err
+	}
+
+	opts, err := gotv.completeGoCommandOptions(specified, tv, opts)
+	if err != nil {
+		return err
+	}
+
+	return gotv.runGoToolchainCommand(tv, opts, args)
+}
+
+// completeGoCommandOptions prepends the cache settings and the default
+// envs of a version to the envs specified in the command line.
+func (gotv *GoTV) completeGoCommandOptions(specified, normalized toolchainVersion, opts goCommandOptions) (goCommandOptions, error) {
+	cacheEnvs, err := gotv.goCachesEnvs(normalized, opts)
+	if err != nil {
+		return opts, err
+	}
+	envs, err := gotv.defaultVersionEnvs(specified, normalized)
+	if err != nil {
+		return opts, err
+	}
+	opts.envs = append(append(cacheEnvs, envs...), opts.envs...)
+	return opts, nil
+}
+
+// After normalization, tv.kind may be only tag/branch/revision
+func (gotv *GoTV) normalizeToolchainVersion(tv *toolchainVersion, dontChangeKind bool) error {
+	if err := tv.options.resolvePatches(); err != nil {
+		return err
+	}
+
+	// Fetch the missing refs and revisions in partial clones.
+	if tv.kind != kind_Source {
+		if _, err := gotv.completeRepository(*tv); err != nil {
+			return err
+		}
+	}
+
+	if tv.kind == kind_Revision {
+		return nil
+	}
+
+	if tv.kind == kind_Tag {
+		if _, ok := gotv.repoInfo.allTags[tv.version]; !ok {
+			return fmt.Errorf("tag %s not found", tv.version)
+		}
+		return nil
+	}
+
+	if tv.kind == kind_Branch {
+		// The branch might be in a removed remote.
+		if _, ok := gotv.repoInfo.allBranches[tv.version]; !ok {
+			return fmt.Errorf("branch %s not found", tv.version)
+		}
+		return nil
+	}
+
+	if tv.kind == kind_Source {
+		var dir, hash = splitSourceVersion(tv.version)
+		if hash != "" {
+			return nil
+		}
+
+		info, err := hashSourceTree(dir)
+		if err != nil {
+			return err
+		}
+		if info.Dirty {
+			fmt.Fprintf(gotv.stdout, "Note: source tree %s has uncommitted changes.\n", gotv.replaceHomeDir(dir))
+		}
+		tv.version = dir + "@" + info.Hash
+		return nil
+	}
+
+	if tv.kind == kind_Release {
+		if prefix, checkLatest := releaseVersionPrefix(tv.version); checkLatest {
+			var latest = ""
+			for tag := range gotv.repoInfo.releaseTags {
+				if strings.HasPrefix(tag, prefix) {
+					if compareVersions(latest, tag) {
+						latest = tag
+					}
+				}
+			}
+
+			if latest == "" {
+				return fmt.Errorf("not latest version found for pseudo-version: %s", tv.version)
+			}
+
+			tv.version = latest
+		}
+
+		if dontChangeKind {
+			// For setDefaultVersion
+			return nil
+		}
+
+		if v := gotv.repoInfo.releaseTags[tv.version]; v == "" {
+			return fmt.Errorf("release version %s not found", tv.version)
+		} else {
+			tv.version = v
+			tv.kind = kind_Tag
+			return nil
+		}
+	}
+
+	if tv.kind == kind_Alias {
+		if tv.version == "tip" {
+			tv.version = "master"
+		} else if v := gotv.repoInfo.versionBranches[tv.version]; v != "" {
+			tv.version = v
+		} else {
+			return fmt.Errorf("release branch %s not found", tv.version)
+		}
+
+		tv.kind = kind_Branch
+		return nil
+	}
+
+	panic("unreachable. tv: " + tv.String())
+}
+
+const gotvInfoFile = "gotv.info"
+
+// toolchainInfo is the content of the gotv.info file
+// in the folder of a built toolchain.
+type toolchainInfo struct {
+	Revision     string   `json:"revision"`
+	Version      string   `json:"version,omitempty"`
+	BuildOptions string   `json:"build-options,omitempty"`
+	BuildEnvs    []string `json:"build-envs,omitempty"`
+	Patches      []string `json:"patches,omitempty"`
+	PatchHash    string   `json:"patch-hash,omitempty"`
+
+	Source          *sourceInfo          `json:"source,omitempty"`
+	Verification    *verificationInfo    `json:"verification,omitempty"`
+	TagVerification *tagVerificationInfo `json:"tag-verification,omitempty"`
+}
+
+func readToolchainInfo(toolchainDir string) (info toolchainInfo, err error) {
+	data, err := os.ReadFile(filepath.Join(toolchainDir, gotvInfoFile))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &info)
+	return
+}
+
+// builtFrom reports whether or not the toolchain described by info is
+// built from the revision with the version and build options of tv.
+// The pinned toolchain folder is shared by all versions, so comparing
+// the revisions is not enough. Old info files only record revisions.
+func (info toolchainInfo) builtFrom(tv toolchainVersion, revision string) bool {
+	if info.Revision != revision {
+		return false
+	}
+	if info.Version == "" {
+		return true
+	}
+	var built = parseGoToolchainVersion(info.Version, true)
+	return built.kind == tv.kind && built.version == tv.version &&
+		info.BuildOptions == tv.options.String() && info.PatchHash == tv.options.patchHash
+}
+
+func writeToolchainInfo(toolchainDir string, info toolchainInfo) error {
+	data, err := json.Marshal(&info)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(toolchainDir, gotvInfoFile), data, 0644)
+}
+
+// releaseVersionPrefix returns the prefix of the release versions
+// matched by a pseudo release version, such as 1., 1.21. and 1.21
+// (since Go 1.21, the first release of 1.21 is 1.21.0). latest is
+// false for exact release versions, such as 1.20 and 1.21.5.
+func releaseVersionPrefix(version string) (prefix string, latest bool) {
+	if strings.HasSuffix(version, ".") {
+		return version[:len(version)-1], true
+	}
+	return version, version >= "1.21" && strings.Count(version, ".") == 1
+}
+
+// cachedTagToolchain returns the folder of the cached toolchain of
+// an exact release version (such as 1.21.5) or a tag, without
+// touching the repository, so that running cached toolchains is
+// fast. Tags are assumed to never move. Use the ! suffix to check
+// them against the repository.
+func (gotv *GoTV) cachedTagToolchain(tv *toolchainVersion) (toolchainDir string, ok bool) {
+	if tv.forceSyncRepo || gotv.verify.enabled {
+		return "", false
+	}
+
+	var tag string
+	switch tv.kind {
+	case kind_Tag:
+		tag = tv.version
+	case kind_Release:
+		if _, latest := releaseVersionPrefix(tv.version); !latest {
+			tag = "go" + tv.version
+		}
+	}
+	if tag == "" || tv.options.resolvePatches() != nil {
+		return "", false
+	}
+
+	var cached = toolchainVersion{kind: kind_Tag, version: tag, options: tv.options}
+	toolchainDir = filepath.Join(gotv.cacheDir, cached.folderName())
+	var goCommandPath = filepath.Join(toolchainDir, "bin", goCommandFilename(cached.options))
+	if _, err := os.Stat(goCommandPath); err != nil {
+		return "", false
+	}
+
+	// The info file is written after a build succeeds.
+	info, err := readToolchainInfo(toolchainDir)
+	if err != nil {
+		return "", false
+	}
+	if v := parseGoToolchainVersion(info.Version, true); v.kind != kind_Tag || v.version != tag {
+		return "", false
+	}
+	if gotv.tagVerificationOutdated(cached, info) {
+		return "", false
+	}
+
+	*tv = cached
+	gotv.versionGoCmdPaths[cached] = goCommandPath
+	return toolchainDir, true
+}
+
+// resolveVersionLocally resolves a release or alias version with the
+// local repository (or the cached toolchains if it doesn't exist),
+// without syncing the repository.
+func (gotv *GoTV) resolveVersionLocally(tv toolchainVersion) (toolchainVersion, bool) {
+	var info repoInfo
+	var err error
+	if gotv.repositoryExists() {
+		info, err = collectRepositoryInfo(gotv.repositoryDir)
+	} else {
+		info, err = collectCachedRepositoryInfo(gotv.cacheDir)
+	}
+	if err != nil {
+		return tv, false
+	}
+
+	switch tv.kind {
+	case kind_Release:
+		var release = tv.version
+		if prefix, latest := releaseVersionPrefix(release); latest {
+			release = ""
+			for r := range info.releaseTags {
+				if strings.HasPrefix(r, prefix) && compareVersions(release, r) {
+					release = r
+				}
+			}
+		}
+		if tag := info.releaseTags[release]; tag != "" {
+			tv.kind, tv.version = kind_Tag, tag
+			return tv, true
+		}
+	case kind_Alias:
+		if tv.version == "tip" {
+			tv.kind, tv.version = kind_Branch, "master"
+			return tv, true
+		}
+		if branch := info.versionBranches[tv.version]; branch != "" {
+			tv.kind, tv.version = kind_Branch, branch
+			return tv, true
+		}
+	}
+	return tv, false
+}
+
+// prepareToolchainVersion syncs the repository for a version (unless
+// it is a local source tree) and normalizes the version. The repository
+// is locked meanwhile, for it might be shared by concurrent builds.
+func (gotv *GoTV) prepareToolchainVersion(tv *toolchainVersion) error {
+	defer gotv.lockRepository()()
+
+	// Local source trees don't need the repository.
+	if tv.kind != kind_Source {
+		if err := gotv.autoFetch(*tv); err != nil {
+			return err
+		}
+		if repoInfo, err := gotv.loadRepositoryInfo(tv.forceSyncRepo); err != nil {
+			return err
+		} else {
+			gotv.repoInfo = repoInfo
+		}
+	}
+
+	return gotv.normalizeToolchainVersion(tv, false)
+}
+
+func (gotv *GoTV) ensureToolchainVersion(tv *toolchainVersion, forPinning bool) (_ string, err error) {
+	if !forPinning {
+		if toolchainDir, ok := gotv.cachedTagToolchain(tv); ok {
+			return toolchainDir, nil
+		}
+	}
+
+	if err := gotv.prepareToolchainVersion(tv); err != nil {
+		return "", err
+	}
+
+	var bootstrapRoot = ""
+	if bootstrapRoot = os.Getenv("GOROOT_BOOTSTRAP"); bootstrapRoot == "" {
+		var bootstrapTV = determineBootstrapToolchainVersion(*tv)
+		if bootstrapTV == nil {
+			return "", errors.New("unable to build toolchain " + tv.String())
+		} else if bootstrapTV.kind != kind_Invalid {
+			bootstrapRoot, err = gotv.ensureToolchainVersion(bootstrapTV, false)
+			if err != nil {
+				return "", err
+			}
+		} else if runtime.GOOS == "windows" {
+			// It looks "make.bat" is unable to determine GOROOT_BOOTSTRAP,
+			// but "make.bash" is able to.
+			goExePath, err := exec.LookPath("go")
+			if err != nil {
+				return "", err
+			}
+			bootstrapRoot = filepath.Dir(filepath.Dir(goExePath))
+		}
+	}
+
+	var goCommandFilename = goCommandFilename(tv.options)
+
+	var goCommandPath, toolchainDir string
+	if forPinning {
+		toolchainDir = gotv.pinnedToolchainDir
+		goCommandPath = filepath.Join(toolchainDir, "bin", goCommandFilename)
+
+		// toolchainDir will be modify later.
+		var realToolchainDir = toolchainDir
+		defer func() {
+			// ToDo: realToolchainDir == toolchainDir is always false?
+			if err != nil || realToolchainDir == toolchainDir {
+				return
+			}
+
+			err = os.RemoveAll(realToolchainDir)
+			if err != nil {
+				return
+			}
+
+			err = os.Rename(toolchainDir, realToolchainDir)
+		}()
+	} else {
+		goCommandPath = filepath.Join(gotv.cacheDir, tv.folderName(), "bin", goCommandFilename)
+		toolchainDir = filepath.Dir(filepath.Dir(goCommandPath))
+
+		// Wait for other builds of the same folder (if any).
+		// The unlocking happens after all the deferred cleanups.
+		defer gotv.folderLocks.lock(tv.folderName())()
+
+		defer func() {
+			if err == nil {
+				gotv.versionGoCmdPaths[*tv] = goCommandPath
+			}
+		}()
+	}
+
+	var infoFilePath = filepath.Join(toolchainDir, gotvInfoFile)
+
+	var revision = gotv.toolchainVersion2Revision(*tv)
+
+	if _, err := os.Stat(infoFilePath); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	} else {
+		var outdated = true
+		var info, err = readToolchainInfo(toolchainDir)
+		if err == nil {
+			outdated = !info.builtFrom(*tv, revision)
+		}
+		if gotv.verify.enabled && !forPinning && info.Verification.failed(gotv.verify) {
+			// A toolchain failing the verification is not used
+			// by verifying builds. Rebuild and verify it again.
+			outdated = true
+		}
+
+		if !outdated && gotv.tagVerificationOutdated(*tv, info) {
+			// Verify the tag of the cached toolchain.
+			if info.TagVerification, err = gotv.verifyTag(tv.version); err != nil {
+				return "", err
+			}
+			if err := writeToolchainInfo(toolchainDir, info); err != nil {
+				return "", err
+			}
+		}
+
+		if !outdated {
+			if gotv.verify.enabled && !forPinning && !info.Verification.matches(gotv.verify) {
+				return toolchainDir, gotv.verifyCachedToolchain(*tv, toolchainDir, info)
+			}
+			return toolchainDir, nil
+		}
+	}
+
+	if forPinning {
+		toolchainDir = gotv.pinnedToolchainDir + "_temp"
+		goCommandPath = filepath.Join(toolchainDir, "bin", goCommandFilename)
+	}
+
+	if gotv.offline && tv.kind != kind_Source && !gotv.repositoryExists() {
+		return "", fmt.Errorf("toolchain %s is not cached and the Go git repository is absent: %w", tv, offlineError("cloning the repository"))
+	}
+
+	var tagVerification *tagVerificationInfo
+	if tv.kind == kind_Tag {
+		if tagVerification, err = gotv.verifyTag(tv.version); err != nil {
+			return "", err
+		}
+	}
+
+	if err := os.RemoveAll(toolchainDir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(toolchainDir)
+		}
+	}()
+
+	buildLog, err := gotv.createBuildLog(*tv, revision)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		buildLog.finish(err)
+		if err != nil {
+			err = fmt.Errorf("%w\n\nThe build log is kept in %s", err, gotv.replaceHomeDir(buildLog.path))
+		}
+	}()
+
+	var source *sourceInfo
+	if tv.kind == kind_Source {
+		info, err := gotv.copySourceTree(*tv, toolchainDir)
+		if err != nil {
+			return "", err
+		}
+		source = &info
+	} else {
+		var unlock = gotv.lockRepository()
+		err = gotv.copyBranchShallowly(*tv, toolchainDir)
+		unlock()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var patches []string
+	if tv.options.patch != "" {
+		if patches, err = tv.options.patchFiles(); err != nil {
+			return "", err
+		}
+		if err := gotv.applyPatches(eventVersion(*tv), patches, toolchainDir, buildLog); err != nil {
+			return "", err
+		}
+	}
+
+	defer func() {
+		if err == nil {
+			os.RemoveAll(filepath.Join(toolchainDir, ".git"))
+			os.Remove(filepath.Join(toolchainDir, ".gitignore"))
+			os.RemoveAll(filepath.Join(toolchainDir, ".github"))
+		}
+	}()
+
+	var makeScript string
+	if runtime.GOOS == "windows" {
+		makeScript = filepath.Join(toolchainDir, "src", "make.bat")
+	} else {
+		makeScript = filepath.Join(toolchainDir, "src", "make.bash")
+	}
+
+	var toolchainSrcDir = filepath.Dir(makeScript)
+	gotv.reportCommand(eventVersion(*tv), gotv.replaceHomeDir(makeScript))
+
+	var optionEnvs = tv.options.buildEnvs()
+	buildEnvs := func() []string {
+		var envs = append([]string{}, optionEnvs...)
+		//if runtime.GOOS == "windows" {
+		if bootstrapRoot != "" {
+			envs = append(envs, "GOROOT_BOOTSTRAP="+bootstrapRoot)
+		}
+
+		return envs
+	}
+
+	buildLog.printf("Bootstrap root: %s\n", bootstrapRoot)
+	buildLog.printf("Build envs: %s\n", strings.Join(buildEnvs(), " "))
+	buildLog.printf("Build script: %s\n\n", makeScript)
+
+	// Each line output by the build script is reported as a build step.
+	var version = eventVersion(*tv)
+	var buildSteps = &eventLineWriter{handle: func(line string) {
+		gotv.report(Event{Kind: EventBuildStep, Phase: PhaseBuild, Version: version, Message: line})
+	}}
+	var finishBuild = startPhase(gotv.report, PhaseBuild, version, "")
+
+	time.Sleep(time.Second / 3) // ToDo: should be unnecessary.
+	_, err = util.RunShellContext(gotv.context(), time.Hour, toolchainSrcDir, buildEnvs, nil, io.MultiWriter(buildSteps, buildLog), io.MultiWriter(gotv.stderr, buildLog), makeScript)
+	buildSteps.Flush()
+	finishBuild(0, err)
+	if err != nil {
+		return "", err
+	}
+
+	if tv.options.goos != "" {
+		if err := arrangeCrossCompiledToolchain(toolchainDir, tv.options); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := os.Stat(goCommandPath); err != nil {
+		return "", err
+	}
+
+	var info = toolchainInfo{
+		Revision:     revision,
+		Version:      tv.String(),
+		BuildOptions: tv.options.String(),
+		BuildEnvs:    optionEnvs,
+		Patches:      patches,
+		PatchHash:    tv.options.patchHash,
+		Source:       source,
+
+		TagVerification: tagVerification,
+	}
+
+	if gotv.verify.enabled && !forPinning {
+		if info.Verification, err = gotv.verifyToolchain(*tv, toolchainDir, buildLog); err != nil {
+			return "", err
+		}
+	}
+	if err := writeToolchainInfo(toolchainDir, info); err != nil {
+		return "", err
+	}
+
+	return toolchainDir, nil
+}
+
+func goCommandFilename(opts buildOptions) string {
+	if goos := opts.goos; goos == "windows" || goos == "" && runtime.GOOS == "windows" {
+		return "go.exe"
+	}
+	return "go"
+}
+
+// arrangeCrossCompiledToolchain makes a cross-compiled toolchain
+// look like a native one on the target platform, just like what
+// the bootstrap.bash script in the Go repository does.
+func arrangeCrossCompiledToolchain(toolchainDir string, opts buildOptions) error {
+	var platform = opts.goos + "_" + opts.goarch
+	var binDir = filepath.Join(toolchainDir, "bin")
+	var targetBinDir = filepath.Join(binDir, platform)
+	if _, err := os.Stat(targetBinDir); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // target platform is the host platform
+		}
+		return err
+	}
+
+	// Replace the host commands with the target ones.
+	entries, err := os.ReadDir(targetBinDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		var name = e.Name()
+		if err := os.Rename(filepath.Join(targetBinDir, name), filepath.Join(binDir, name)); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(targetBinDir); err != nil {
+		return err
+	}
+	os.Remove(filepath.Join(binDir, "go_"+platform+"_exec"))
+
+	// Remove the host tools.
+	var toolDir = filepath.Join(toolchainDir, "pkg", "tool")
+	if entries, err = os.ReadDir(toolDir); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() && e.Name() != platform {
+			if err := os.RemoveAll(filepath.Join(toolDir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	os.RemoveAll(filepath.Join(toolchainDir, "pkg", "bootstrap"))
+	os.RemoveAll(filepath.Join(toolchainDir, "pkg", "obj"))
+	return nil
+}
+
+// The returned error is an *exec.ExitError if the go command fails.
+// The gotv program exits with the same exit code in this case.
+func (gotv *GoTV) runGoToolchainCommand(tv toolchainVersion, opts goCommandOptions, args []string) error {
+	return gotv.runGoToolchainCommandWithIO(tv, opts, args, os.Stdin, gotv.stdout, gotv.stderr)
+}
+
+// runGoToolchainCommandWithIO runs a go command of a built toolchain.
+// The returned error is an *exec.ExitError if the command fails.
+func (gotv *GoTV) runGoToolchainCommandWithIO(tv toolchainVersion, opts goCommandOptions, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	goCommandPath, ok := gotv.versionGoCmdPaths[tv]
+	if !ok {
+		panic("toochain version " + tv.String() + " is not built?")
+	}
+	if _, err := os.Stat(goCommandPath); err != nil {
+		return err
+	}
+
+	fmt.Fprint(gotv.stdout, "[Run]: ")
+	for _, e := range opts.envs {
+		fmt.Fprint(gotv.stdout, e, " ")
+	}
+	fmt.Fprint(gotv.stdout, gotv.replaceHomeDir(goCommandPath))
+	for _, a := range args {
+		fmt.Fprint(gotv.stdout, " ", a)
+	}
+	fmt.Fprintln(gotv.stdout)
+
+	// The PATH env var is only changed for the command, so that
+	// commands of different toolchains may run concurrently.
+	var path = filepath.Dir(goCommandPath)
+	if oldpath := os.Getenv("PATH"); oldpath != "" {
+		path += string(os.PathListSeparator) + oldpath
+	}
+	buildEnv := func() []string {
+		return append([]string{
+			"PATH=" + path,
+			// https://github.com/golang/go/issues/57001
+			"GOTOOLCHAIN=local",
+		}, opts.envs...) // later ones take effect
+	}
+	_, err := util.RunShellCommandContext(gotv.context(), time.Hour, "", buildEnv, stdin, stdout, stderr, goCommandPath, args...)
+	return err
+}
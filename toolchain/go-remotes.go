@@ -0,0 +1,94 @@
+package toolchain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+)
+
+// Besides origin, the repository may have other remotes, such as
+// forks of the Go project. Their branches are referenced in
+// versions as bra:REMOTE/BRANCH. Their tags are not fetched.
+
+var remoteNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+func (gotv *GoTV) addRemote(name, repoAddr string) error {
+	if name == git.DefaultRemoteName {
+		return errors.New("the origin remote can't be added")
+	}
+	if !remoteNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid remote name: %s", name)
+	}
+
+	if gotv.offline {
+		return offlineError("add-remote")
+	}
+	if _, err := gotv.ensureGoRepository(false); err != nil {
+		return err
+	}
+
+	gotv.reportCommand("", "git remote add", name, gotv.replaceHomeDir(repoAddr))
+	gotv.reportCommand("", "git fetch", name)
+	if err := gitAddRemote(gotv.context(), gotv.repositoryDir, name, repoAddr, gotv.report, gotv.userInput()); err != nil {
+		return err
+	}
+
+	repoInfo, err := collectRepositoryInfo(gotv.repositoryDir)
+	if err != nil {
+		return err
+	}
+	var numBranches = 0
+	for bra := range repoInfo.allBranches {
+		if strings.HasPrefix(bra, name+"/") {
+			numBranches++
+		}
+	}
+
+	fmt.Fprintf(gotv.stdout, "Remote %s is added, with %d branches. Use them as bra:%s/BRANCH.\n", name, numBranches, name)
+	return nil
+}
+
+func (gotv *GoTV) removeRemote(name string) error {
+	if name == git.DefaultRemoteName {
+		return errors.New("the origin remote can't be removed")
+	}
+
+	if _, err := gotv.ensureGoRepository(false); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(gotv.stdout, "[Run]: git remote remove", name)
+	if err := gitRemoveRemote(gotv.repositoryDir, name); err != nil {
+		if err == git.ErrRemoteNotFound {
+			return fmt.Errorf("remote %s is not found", name)
+		}
+		return err
+	}
+	return nil
+}
+
+func (gotv *GoTV) listRemotes() error {
+	if _, err := gotv.ensureGoRepository(false); err != nil {
+		return err
+	}
+
+	remotes, err := gitListRemotes(gotv.repositoryDir)
+	if err != nil {
+		return err
+	}
+
+	var names = make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(gotv.stdout, "%s\t%s\n", name, gotv.replaceHomeDir(remotes[name]))
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package toolchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	"go101.org/gotv/internal/util"
+)
+
+// offlineError is returned when an operation needing network
+// access is requested in offline mode.
+func offlineError(what string) error {
+	return fmt.Errorf("%s needs network access, but gotv is offline (GOTV_OFFLINE=1 or -offline)", what)
+}
+
+func (gotv *GoTV) repositoryExists() bool {
+	_, err := os.Stat(gotv.repositoryDir)
+	return err == nil
+}
+
+func (gotv *GoTV) ensureGoRepository(pullOnExist bool) (pulled bool, err error) {
+	if gotv.offline {
+		if pullOnExist {
+			return false, offlineError("fetching remote versions (the ! suffix)")
+		}
+		if !gotv.repositoryExists() {
+			return false, offlineError("cloning the Go git repository")
+		}
+		return false, nil
+	}
+
+	_, err = os.Stat(gotv.repositoryDir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+	} else {
+		_, err = gitWorktree(gotv.repositoryDir)
+		if err != nil {
+			// Don't remove it, it might be recoverable.
+			return false, fmt.Errorf("the Go git repository (%s) is broken: %w\nPlease run \"gotv doctor\" to check it.", gotv.replaceHomeDir(gotv.repositoryDir), err)
+		}
+
+		if pullOnExist {
+			pulled = true
+
+			gotv.reportCommand("", "git fetch --all (in "+gotv.replaceHomeDir(gotv.repositoryDir)+")")
+			_, err = gitFetch(gotv.context(), gotv.repositoryDir, gotv.originConfig(), gotv.report, gotv.userInput())
+			if err == nil {
+				err = refreshRepositoryIndex(gotv.repositoryDir)
+			} else if err == git.NoErrAlreadyUpToDate {
+				err = nil
+			}
+			if err == nil {
+				recordFetchTime(gotv.repositoryDir)
+			}
+		}
+
+		return
+	}
+
+	// clone it
+
+	pulled = true
+
+	defer func() {
+		if err != nil {
+			os.RemoveAll(gotv.repositoryDir)
+		}
+	}()
+
+	err = os.MkdirAll(gotv.cacheDir, 0700)
+	if err != nil {
+		return
+	}
+
+	var origin = gotv.originConfig()
+	var repoAddrs = repositoryURLs(gotv.repositoryURL, origin.Mirrors)
+	if len(repoAddrs) == 0 {
+		if gotv.stdin == nil {
+			return false, fmt.Errorf("the Go git repository address is not specified: %w", errNoUserInput)
+		}
+		fmt.Fprintln(gotv.stdout, `Please specify the Go project repository git address.
+Generally, it should be one of the following ones:
+* https://go.googlesource.com/go
+* https://github.com/golang/go.git
+* git@github.com:golang/go.git`)
+
+		fmt.Fprintln(gotv.stdout)
+	}
+
+	for len(repoAddrs) == 0 {
+		var repoAddr string
+		if repoAddr, err = gotv.userInput().ask(`Specify it here: `); err != nil {
+			return
+		}
+		if repoAddr != "" {
+			repoAddrs = append(repoAddrs, repoAddr)
+		}
+	}
+
+	var packDir = filepath.Join(gotv.repositoryDir, ".git", "objects", "pack")
+	_, _, err = tryRepositoryURLs(gotv.context(), repoAddrs, repoAddrs[0], origin.Timeout, packDir, gotv.report, gotv.userInput(), func(ctx context.Context, repoAddr string, auth gittransport.AuthMethod, report func(Event)) error {
+		gotv.reportCommand("", "git clone", gotv.replaceHomeDir(repoAddr), gotv.replaceHomeDir(gotv.repositoryDir))
+		err := gitClone(ctx, repoAddr, auth, gotv.repositoryDir, gotv.cloneOptions, report)
+		if err != nil {
+			os.RemoveAll(gotv.repositoryDir) // to try the next one
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	err = refreshRepositoryIndex(gotv.repositoryDir)
+	if err == nil {
+		recordFetchTime(gotv.repositoryDir)
+	}
+	return
+}
+
+func (gotv *GoTV) copyBranchShallowly(tv toolchainVersion, toDir string) (err error) {
+	var repoDir = gotv.repositoryDir
+	var version = eventVersion(tv)
+
+	switch tv.kind {
+	case kind_Tag, kind_Branch, kind_Revision:
+		var finish = startPhase(gotv.report, PhaseCheckout, version, tv.version)
+		defer func() {
+			finish(0, err)
+		}()
+
+		gotv.reportCommand(version, "cp -r", gotv.replaceHomeDir(repoDir), gotv.replaceHomeDir(toDir))
+		err = util.CopyDir(repoDir, toDir)
+		if err != nil {
+			return err
+		}
+
+		gotv.reportCommand(version, "cd", gotv.replaceHomeDir(toDir))
+
+		var o = git.CheckoutOptions{Force: true, Keep: false}
+		if tv.kind == kind_Revision {
+			o.Hash = plumbing.NewHash(tv.version)
+		} else if tv.kind == kind_Tag {
+			o.Branch = plumbing.NewTagReferenceName(tv.version)
+		} else { // tv.kind == kind_Branch
+			// The branch might be in a remote other than origin.
+			if o.Branch, err = gitRemoteBranchReference(repoDir, tv.version); err != nil {
+				return err
+			}
+			// o.Create = true
+			// ToDo: not work. how to create local branches using go-git?
+			// Use a walkaround to avoid creating local branches now.
+			// But this is a question needing an answer.
+		}
+
+		gotv.reportCommand(version, "git checkout", tv.version)
+		if readCloneOptions(repoDir).Strategy == cloneStrategy_Blobless {
+			// go-git can't fetch the missing objects of partial clones.
+			err = gitCheckoutWithCommand(gotv.context(), toDir, gotv.toolchainVersion2Revision(tv))
+		} else {
+			err = gitCheckout(toDir, &o)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		panic("unsupported version kinds")
+	}
+
+	return nil
+}
+
+// loadRepositoryInfo makes sure the repository is cloned (and fetched
+// if pull is true), then collects its info. In offline mode, if the
+// repository doesn't exist, the info is collected from the cached
+// toolchain folders instead.
+func (gotv *GoTV) loadRepositoryInfo(pull bool) (repoInfo, error) {
+	if gotv.offline && !pull && !gotv.repositoryExists() {
+		return collectCachedRepositoryInfo(gotv.cacheDir)
+	}
+
+	if _, err := gotv.ensureGoRepository(pull); err != nil {
+		return repoInfo{}, err
+	}
+	return collectRepositoryInfo(gotv.repositoryDir)
+}
+
+var (
+	releaseTagRegexp    = regexp.MustCompile(`^go([1-9]([0-9]*).*)`)
+	releaseBranchRegexp = regexp.MustCompile(`^(release-branch.go([1-9]([0-9]*).*))`)
+)
+
+// releaseOfTag returns the simplified name of a release tag,
+// such as 1.21.5 for go1.21.5, or "" for other tags.
+func releaseOfTag(tag string) string {
+	if ms := releaseTagRegexp.FindAllStringSubmatch(tag, 1); len(ms) > 0 {
+		return ms[0][1]
+	}
+	return ""
+}
+
+// releaseOfBranch returns the simplified name of a version branch,
+// such as 1.21 for release-branch.go1.21, or "" for other branches.
+func releaseOfBranch(branch string) string {
+	if ms := releaseBranchRegexp.FindAllStringSubmatch(branch, 1); len(ms) > 0 {
+		return ms[0][2]
+	}
+	return ""
+}
+
+// collectRepositoryInfo collects the info of the repository from
+// its index, which is rebuilt only if the references are changed.
+func collectRepositoryInfo(repoDir string) (repoInfo repoInfo, err error) {
+	index, err := loadRepositoryIndex(repoDir)
+	if err != nil {
+		return
+	}
+
+	repoInfo.allTags = make(map[string]string, len(index.Tags))
+	repoInfo.releaseTags = make(map[string]string, len(index.Tags))
+	repoInfo.tagDates = make(map[string]time.Time, len(index.Tags))
+	for t, ref := range index.Tags {
+		repoInfo.allTags[t] = ref.Hash
+		if !ref.Date.IsZero() {
+			repoInfo.tagDates[t] = ref.Date
+		}
+		if ref.Release != "" {
+			repoInfo.releaseTags[ref.Release] = t
+		}
+	}
+
+	repoInfo.allBranches = make(map[string]string, len(index.Branches))
+	repoInfo.versionBranches = make(map[string]string, len(index.Branches))
+	for b, ref := range index.Branches {
+		repoInfo.allBranches[b] = ref.Hash
+		if ref.Release != "" {
+			repoInfo.versionBranches[ref.Release] = b
+		} else if b == "master" {
+			repoInfo.tipHash = ref.Hash
+		}
+	}
+
+	return
+}
+
+// collectCachedRepositoryInfo collects the tags and branches (with
+// the revisions they were built at) of the cached toolchains.
+// It is used in offline mode when the repository doesn't exist.
+func collectCachedRepositoryInfo(cacheDir string) (repoInfo repoInfo, err error) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+
+	repoInfo.allTags = make(map[string]string, len(entries))
+	repoInfo.releaseTags = make(map[string]string, len(entries))
+	repoInfo.allBranches = make(map[string]string, 16)
+	repoInfo.versionBranches = make(map[string]string, 16)
+	for _, e := range entries {
+		var name = e.Name()
+		if !e.IsDir() || !strings.HasPrefix(name, "tag_") && !strings.HasPrefix(name, "bra_") {
+			continue
+		}
+		info, err := readToolchainInfo(filepath.Join(cacheDir, name))
+		if err != nil {
+			continue // not a completely built toolchain
+		}
+		switch tv := parseGoToolchainVersion(info.Version, true); tv.kind {
+		case kind_Tag:
+			repoInfo.allTags[tv.version] = info.Revision
+			if r := releaseOfTag(tv.version); r != "" {
+				repoInfo.releaseTags[r] = tv.version
+			}
+		case kind_Branch:
+			repoInfo.allBranches[tv.version] = info.Revision
+			if r := releaseOfBranch(tv.version); r != "" {
+				repoInfo.versionBranches[r] = tv.version
+			} else if tv.version == "master" {
+				repoInfo.tipHash = info.Revision
+			}
+		}
+	}
+
+	return repoInfo, nil
+}
@@ -1,8 +1,9 @@
-package main
+package toolchain
 
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -32,12 +33,19 @@ const (
 	// :tip  (<=> bra:master)
 	// :1.18 (<=> bra:release-branch.go1.18)
 	kind_Alias
+
+	// src:~/go-dev (a local Go source tree)
+	// After normalization, the version is suffixed with
+	// the content hash of the tree, such as
+	// /home/me/go-dev@0123456789abcdef.
+	kind_Source
 )
 
 type toolchainVersion struct {
 	kind          versionKind
 	version       string
 	forceSyncRepo bool
+	options       buildOptions
 }
 
 func (tv toolchainVersion) IsInvalid() (bool, string) {
@@ -50,9 +58,9 @@ func (tv toolchainVersion) IsInvalid() (bool, string) {
 }
 
 func (tv toolchainVersion) String() string {
-	var suffix = ""
+	var suffix = tv.options.String()
 	if tv.forceSyncRepo {
-		suffix = "!"
+		suffix += "!"
 	}
 	switch tv.kind {
 	case kind_Tag:
@@ -65,6 +73,8 @@ func (tv toolchainVersion) String() string {
 		return "" + tv.version + suffix
 	case kind_Alias:
 		return ":" + tv.version + suffix
+	case kind_Source:
+		return "src:" + tv.version + suffix
 	}
 
 	return fmt.Sprintf("{%v, %v}", tv.kind, tv.version) // invalid
@@ -78,18 +88,57 @@ func (tv toolchainVersion) folderName() string {
 	case kind_Tag:
 		folder = "tag_" + tv.version
 	case kind_Branch:
-		folder = "bra_" + tv.version
+		// Branches in remotes other than origin are named as REMOTE/BRANCH.
+		// Slashes are percent-encoded (so is the percent sign), so that
+		// branch names never collide, such as fork/x and fork_x.
+		folder = "bra_" + branchFolderEscaper.Replace(tv.version)
 	case kind_Revision:
 		folder = "rev_" + tv.version
+	case kind_Source:
+		var _, hash = splitSourceVersion(tv.version)
+		if hash == "" {
+			panic("source tree is not hashed: " + tv.version)
+		}
+		folder = "src_" + hash
+	}
+
+	return folder + tv.options.folderSuffix()
+}
+
+var branchFolderEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+
+const sourceHashLength = 16
+
+// splitSourceVersion splits a normalized source version
+// into the directory and the content hash parts.
+// The hash part is blank for non-normalized versions.
+func splitSourceVersion(version string) (dir, hash string) {
+	if i := strings.LastIndexByte(version, '@'); i >= 0 && isSourceHash(version[i+1:]) {
+		return version[:i], version[i+1:]
 	}
+	return version, ""
+}
 
-	return folder
+func isSourceHash(s string) bool {
+	return isLowerHex(s, sourceHashLength)
+}
+
+func isLowerHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
 }
 
 func parseGoToolchainVersion(arg string, argIsVersionForSure bool) toolchainVersion {
 	arg = strings.TrimSpace(arg)
 	if len(arg) == 0 {
-		return toolchainVersion{kind_Invalid, "version is unspecified", false}
+		return toolchainVersion{kind_Invalid, "version is unspecified", false, buildOptions{}}
 	}
 
 	forceSyncRepo := strings.HasSuffix(arg, "!")
@@ -97,45 +146,67 @@ func parseGoToolchainVersion(arg string, argIsVersionForSure bool) toolchainVers
 		arg = strings.TrimSpace(arg[:len(arg)-1])
 
 		if len(arg) == 0 {
-			return toolchainVersion{kind_Invalid, "! should not be used solely as an argument", true}
+			return toolchainVersion{kind_Invalid, "! should not be used solely as an argument", true, buildOptions{}}
+		}
+	}
+
+	var opts buildOptions
+	if i := strings.IndexByte(arg, '+'); i >= 0 {
+		var err error
+		if opts, err = parseBuildOptions(arg[i+1:]); err != nil {
+			return toolchainVersion{kind_Invalid, err.Error(), forceSyncRepo, buildOptions{}}
+		}
+		arg = strings.TrimSpace(arg[:i])
+		if len(arg) == 0 {
+			return toolchainVersion{kind_Invalid, "build options must follow a version", forceSyncRepo, buildOptions{}}
 		}
 	}
 
 	if arg == "." {
-		return toolchainVersion{kind_Release, arg, forceSyncRepo}
+		return toolchainVersion{kind_Release, arg, forceSyncRepo, opts}
 	}
 	if c := arg[0]; '0' <= c && c <= '9' {
 		if arg < "1.21" {
 			arg = trimTaillingDotZeros(arg)
 		}
-		return toolchainVersion{kind_Release, arg, forceSyncRepo}
+		return toolchainVersion{kind_Release, arg, forceSyncRepo, opts}
 	}
 
 	i := strings.IndexByte(arg, ':')
 	if i < 0 {
-		if forceSyncRepo || argIsVersionForSure {
-			return toolchainVersion{kind_Invalid, "unrecognized command or invalid version: " + arg, forceSyncRepo}
+		if forceSyncRepo || argIsVersionForSure || opts != (buildOptions{}) {
+			return toolchainVersion{kind_Invalid, "unrecognized command or invalid version: " + arg, forceSyncRepo, buildOptions{}}
 		}
 		// View arg as a go command.
 
-		return toolchainVersion{kind_Default, "", false} // kind_Default and forceSyncRepo always conflicts.
+		return toolchainVersion{kind_Default, "", false, buildOptions{}} // kind_Default and forceSyncRepo always conflicts.
 	}
 
 	kind, version := arg[:i], arg[i+1:]
 
 	if len(version) == 0 {
-		return toolchainVersion{kind_Invalid, "unspecified version for kind (" + kind + ")", forceSyncRepo}
+		return toolchainVersion{kind_Invalid, "unspecified version for kind (" + kind + ")", forceSyncRepo, buildOptions{}}
 	}
 
 	switch kind {
 	default:
-		return toolchainVersion{kind_Invalid, "undetermined version kind: " + kind, forceSyncRepo}
+		return toolchainVersion{kind_Invalid, "undetermined version kind: " + kind, forceSyncRepo, buildOptions{}}
 	case "tag":
-		return toolchainVersion{kind_Tag, version, forceSyncRepo}
+		return toolchainVersion{kind_Tag, version, forceSyncRepo, opts}
 	case "bra":
-		return toolchainVersion{kind_Branch, version, forceSyncRepo}
+		return toolchainVersion{kind_Branch, version, forceSyncRepo, opts}
 	case "rev":
-		return toolchainVersion{kind_Revision, version, forceSyncRepo}
+		return toolchainVersion{kind_Revision, version, forceSyncRepo, opts}
+	case "src":
+		var dir, hash = splitSourceVersion(version)
+		dir, err := filepath.Abs(expandHomeDir(dir))
+		if err != nil {
+			return toolchainVersion{kind_Invalid, err.Error(), forceSyncRepo, buildOptions{}}
+		}
+		if hash != "" {
+			dir += "@" + hash
+		}
+		return toolchainVersion{kind_Source, dir, forceSyncRepo, opts}
 	case "": // alias versions
 	}
 
@@ -143,12 +214,12 @@ func parseGoToolchainVersion(arg string, argIsVersionForSure bool) toolchainVers
 
 	if version != "tip" {
 		if c := version[0]; c < '0' || c > '9' {
-			return toolchainVersion{kind_Invalid, "an alias version must be tip or a go version", forceSyncRepo}
+			return toolchainVersion{kind_Invalid, "an alias version must be tip or a go version", forceSyncRepo, buildOptions{}}
 		}
 		version = trimTaillingDotZeros(version)
 	}
 
-	return toolchainVersion{kind_Alias, version, forceSyncRepo}
+	return toolchainVersion{kind_Alias, version, forceSyncRepo, opts}
 }
 
 func parseGoToolchainVersions(versions ...string) ([]toolchainVersion, error) {
@@ -248,6 +319,8 @@ func determineBootstrapToolchainVersion(tv toolchainVersion) *toolchainVersion {
 
 		// Try to use local toolchain installation.
 		return &toolchainVersion{kind: kind_Invalid}
+	case kind_Source:
+		return &toolchainVersion{kind: kind_Invalid}
 	}
 
 	return nil
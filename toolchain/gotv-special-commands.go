@@ -0,0 +1,632 @@
+package toolchain
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	//"go101.org/gotv/internal/util"
+)
+
+type unknownCommand struct{}
+
+func (unknownCommand) Error() string {
+	return "unknown command"
+}
+
+func (gotv *GoTV) tryRunningSpecialCommand(args []string) error {
+	command, args := args[0], args[1:]
+	switch command {
+	case "fetch-version", "fetch-versions":
+		if len(args) > 0 {
+			return errors.New(`fetch-versions needs no arguments`)
+		}
+		return gotv.fetchVersions()
+	case "list-version", "list-versions":
+		return gotv.listVersions(args...)
+	case "cache-version", "cache-versions":
+		return gotv.cacheVersion(args...)
+	case "export-version":
+		return gotv.exportVersion(args...)
+	case "import-version":
+		return gotv.importVersion(args...)
+	case "build-log":
+		if len(args) != 1 {
+			return errors.New(`build-log needs exact one argument`)
+		}
+		return gotv.showBuildLog(args[0])
+	case "uncache-version", "uncache-versions":
+		return gotv.uncacheVersion(args...)
+	case "pin-version":
+		if len(args) != 1 {
+			return errors.New(`pin-version needs exact one argument`)
+		}
+		return gotv.pinVersion(args[0])
+	case "unpin-version":
+		if len(args) > 0 {
+			return errors.New(`unpin-version needs no arguments`)
+		}
+		return gotv.unpinVersion()
+	case "default-version":
+		switch len(args) {
+		case 0:
+			return gotv.checkDefaultVersion()
+		case 1:
+			return gotv.setDefaultVersion(args[0])
+		default:
+			return errors.New(`default-version needs at least one argument`)
+		}
+	case "diff":
+		return gotv.diffVersions(args...)
+	case "bench":
+		return gotv.benchVersions(args...)
+	case "default-caches":
+		return gotv.setDefaultCaches(args...)
+	case "init-repo":
+		return gotv.initRepository(args...)
+	case "fetch-interval":
+		return gotv.setFetchInterval(args...)
+	case "fetch-refspecs":
+		return gotv.setFetchRefSpecs(args...)
+	case "mirrors":
+		return gotv.setMirrors(args...)
+	case "verify-tags":
+		return gotv.setTagVerification(args...)
+	case "record-release-commits":
+		return gotv.recordReleaseCommits(args...)
+	case "doctor":
+		return gotv.doctor(args...)
+	case "clean-caches":
+		return gotv.cleanGoCaches(args...)
+	case "list-remotes":
+		if len(args) > 0 {
+			return errors.New(`list-remotes needs no arguments`)
+		}
+		return gotv.listRemotes()
+	case "add-remote":
+		if len(args) != 2 {
+			return errors.New(`add-remote needs exact two arguments`)
+		}
+		return gotv.addRemote(args[0], args[1])
+	case "remove-remote":
+		if len(args) != 1 {
+			return errors.New(`remove-remote needs exact one argument`)
+		}
+		return gotv.removeRemote(args[0])
+	case "default-envs":
+		if len(args) == 0 {
+			return gotv.listDefaultEnvs()
+		}
+		return gotv.setDefaultEnvs(args[0], args[1:]...)
+	}
+
+	return unknownCommand{}
+}
+
+func newFlagSet(command string) *flag.FlagSet {
+	var flags = flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return flags
+}
+
+// parseFlags allows flags to be mixed with non-flag arguments,
+// which are returned.
+func parseFlags(flags *flag.FlagSet, args []string) (nonFlagArgs []string, err error) {
+	for {
+		if err = flags.Parse(args); err != nil {
+			return nil, fmt.Errorf("%s: %w", flags.Name(), err)
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return nonFlagArgs, nil
+		}
+		nonFlagArgs = append(nonFlagArgs, args[0])
+		args = args[1:]
+	}
+}
+
+func (gotv *GoTV) fetchVersions() error {
+	if gotv.offline {
+		return offlineError("fetch-versions")
+	}
+
+	return gotv.syncRepositoryAndReport()
+}
+
+// syncRepositoryAndReport fetches the remote versions (or clones the
+// repository if it hasn't been cloned), then prints what changed.
+func (gotv *GoTV) syncRepositoryAndReport() error {
+	var err error
+	var cloned bool
+	var pruned []string
+	if cloned, err = gotv.ensureGoRepository(false); err != nil {
+		return err
+	}
+
+	var oldRepoInfo repoInfo
+	if !cloned {
+		oldRepoInfo, err = collectRepositoryInfo(gotv.repositoryDir)
+		if err != nil {
+			return err
+		}
+
+		gotv.reportCommand("", "git fetch --all (in "+gotv.replaceHomeDir(gotv.repositoryDir)+")")
+
+		pruned, err = gitFetch(gotv.context(), gotv.repositoryDir, gotv.originConfig(), gotv.report, gotv.userInput())
+		if err == nil {
+			err = refreshRepositoryIndex(gotv.repositoryDir)
+		}
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return err
+		}
+		recordFetchTime(gotv.repositoryDir)
+	}
+
+	newRepoInfo, err := collectRepositoryInfo(gotv.repositoryDir)
+	if err != nil {
+		return err
+	}
+
+	printRepositoryChanges(gotv.stdout, oldRepoInfo, newRepoInfo)
+
+	if len(pruned) > 0 {
+		sort.Strings(pruned)
+		fmt.Fprintln(gotv.stdout)
+		fmt.Fprintln(gotv.stdout, "Removed references (deleted in remotes):")
+		for _, name := range pruned {
+			fmt.Fprintf(gotv.stdout, "\t%s\n", name)
+		}
+	}
+	return nil
+}
+
+// printRepositoryChanges prints the changes of version branches,
+// releases and the tip between two snapshots of the repository.
+func printRepositoryChanges(w io.Writer, oldRepoInfo, newRepoInfo repoInfo) {
+	var updatedVersionBranches = make([]string, 0, 32)
+	var newVersionBranches = make([]string, 0, 8)
+	var newReleaseTags = make([]string, 0, 32)
+	for bra := range newRepoInfo.versionBranches {
+		if fullName, ok := oldRepoInfo.versionBranches[bra]; ok {
+			if oldRepoInfo.allBranches[fullName] != newRepoInfo.allBranches[fullName] {
+				updatedVersionBranches = append(updatedVersionBranches, bra)
+			}
+		} else {
+			newVersionBranches = append(newVersionBranches, bra)
+		}
+	}
+	for tag := range newRepoInfo.releaseTags {
+		if _, ok := oldRepoInfo.releaseTags[tag]; ok {
+		} else {
+			newReleaseTags = append(newReleaseTags, tag)
+		}
+	}
+	var tipChanged = oldRepoInfo.tipHash != newRepoInfo.tipHash
+
+	sortVersions(updatedVersionBranches)
+	sortVersions(newVersionBranches)
+	sortVersions(newReleaseTags)
+
+	var needNewLine = false
+
+	if len(updatedVersionBranches) > 0 {
+		if needNewLine {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "Updated version branches:")
+		for _, bra := range updatedVersionBranches {
+			fmt.Fprintf(w, "\t%s\n", bra)
+		}
+		needNewLine = true
+	}
+
+	if len(newReleaseTags) == 0 && len(newVersionBranches) == 0 {
+		if needNewLine {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "No new releases and version branches are found.")
+	}
+
+	if len(newVersionBranches) > 0 {
+		if needNewLine {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "New version branches:")
+		for _, bra := range newVersionBranches {
+			fmt.Fprintf(w, "\t%s\n", bra)
+		}
+		needNewLine = true
+	}
+	if len(newReleaseTags) > 0 {
+		if needNewLine {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "New releases:")
+		for _, tag := range newReleaseTags {
+			fmt.Fprintf(w, "\t%s\n", tag)
+		}
+		needNewLine = true
+	}
+
+	if tipChanged {
+		if needNewLine {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "Tip changed.")
+	}
+}
+
+func (gotv *GoTV) listVersions(args ...string) error {
+	reposInfo, err := gotv.loadRepositoryInfo(false)
+	if err != nil {
+		return err
+	}
+
+	var versionBranches = make([]string, 0, 8)
+	var releaseTags = make([]string, 0, 32)
+	for bra := range reposInfo.versionBranches {
+		versionBranches = append(versionBranches, bra)
+	}
+	for tag := range reposInfo.releaseTags {
+		releaseTags = append(releaseTags, tag)
+	}
+
+	if len(releaseTags) == 0 && len(versionBranches) == 0 {
+		fmt.Fprintln(gotv.stdout, "No releases and version branches are found.")
+	}
+
+	sortVersions(versionBranches)
+	sortVersions(releaseTags)
+
+	if len(versionBranches) > 0 {
+		fmt.Fprintln(gotv.stdout, "Version branches:")
+		for _, bra := range versionBranches {
+			fmt.Fprintf(gotv.stdout, "\t%s\n", bra)
+		}
+	}
+	fmt.Fprintln(gotv.stdout)
+	if len(releaseTags) > 0 {
+		var width = 0
+		for _, tag := range releaseTags {
+			if len(tag) > width {
+				width = len(tag)
+			}
+		}
+
+		fmt.Fprintln(gotv.stdout, "Releases:")
+		for _, tag := range releaseTags {
+			if date, ok := reposInfo.tagDates[reposInfo.releaseTags[tag]]; ok {
+				fmt.Fprintf(gotv.stdout, "\t%-*s  %s\n", width, tag, date.Format("2006-01-02"))
+			} else {
+				fmt.Fprintf(gotv.stdout, "\t%s\n", tag)
+			}
+		}
+	}
+
+	// ToDo: labels: cached, pinned, outdated, ...
+
+	return nil
+}
+
+func (gotv *GoTV) cacheVersion(args ...string) error {
+	var flags = newFlagSet("cache-version")
+	var target = flags.String("target", "", "")
+	var archive = flags.Bool("archive", false, "")
+	var parallel = flags.Int("j", 1, "")
+	var keepGoing = flags.Bool("k", false, "")
+	var verify verifyOptions
+	flags.BoolVar(&verify.enabled, "verify", false, "")
+	flags.StringVar(&verify.run, "verify-run", "", "")
+	versions, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if verify.run != "" {
+		verify.enabled = true
+	}
+	if len(versions) == 0 {
+		return errors.New(`cache-version needs at least one version argument`)
+	}
+	if *parallel < 1 {
+		return errors.New(`the -j option of cache-version must be positive`)
+	}
+
+	tvs, err := parseGoToolchainVersions(versions...)
+	if err != nil {
+		return err
+	}
+
+	if *target != "" {
+		opts, err := parseBuildOptions("target=" + *target)
+		if err != nil {
+			return err
+		}
+		for i := range tvs {
+			tvs[i].options.goos, tvs[i].options.goarch = opts.goos, opts.goarch
+		}
+	}
+
+	if verify.enabled {
+		for _, tv := range tvs {
+			if tv.options.isCrossCompiled() {
+				return fmt.Errorf("toolchain %s is built for %s, it can't be verified on this host", tv, tv.options.target())
+			}
+		}
+	}
+
+	// The verification options only apply to the builds of this call.
+	var session = *gotv
+	session.verify = verify
+	gotv = &session
+
+	// The repository is shared by all the builds,
+	// so make sure it is ready before building.
+	// Local source trees don't need it.
+	var removed = clearForceSyncRepoFrromVersions(tvs)
+	var needRepository bool
+	for i := range tvs {
+		if tvs[i].kind != kind_Source {
+			needRepository = true
+			break
+		}
+	}
+	if needRepository {
+		var unlock = gotv.lockRepository()
+		if _, err = gotv.loadRepositoryInfo(removed); err == nil {
+			err = gotv.autoFetch(tvs...)
+		}
+		unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	var cache = cacheVersionJob(*archive)
+	if *parallel == 1 && !*keepGoing {
+		for i := range tvs {
+			if err := cache(gotv, &tvs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var jobs = newVersionJobs(versions, tvs)
+	gotv.runVersionJobs(jobs, *parallel, *keepGoing, cache)
+	return gotv.printVersionJobsSummary(jobs, "cached")
+}
+
+func cacheVersionJob(archive bool) versionJobFunc {
+	return func(gotv *GoTV, tv *toolchainVersion) error {
+		toolchainDir, err := gotv.ensureToolchainVersion(tv, false)
+		if err != nil {
+			return err
+		}
+
+		if archive {
+			return gotv.writeToolchainArchive(toolchainDir, tv.folderName()+".tar.gz")
+		}
+		return nil
+	}
+}
+
+func (gotv *GoTV) uncacheVersion(args ...string) error {
+	var flags = newFlagSet("uncache-version")
+	var keepGoing = flags.Bool("k", false, "")
+	versions, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return errors.New(`uncache-version needs at least one version argument`)
+	}
+
+	gotv.repoInfo, err = gotv.loadRepositoryInfo(false)
+	if err != nil {
+		return err
+	}
+
+	tvs, err := parseGoToolchainVersions(versions...)
+	if err != nil {
+		return err
+	}
+
+	var removed = clearForceSyncRepoFrromVersions(tvs)
+	if removed {
+		fmt.Fprintln(gotv.stdout, "The ! sign is ignored.")
+	}
+
+	if !*keepGoing {
+		for i := range tvs {
+			if err := uncacheVersionJob(gotv, &tvs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var jobs = newVersionJobs(versions, tvs)
+	gotv.runVersionJobs(jobs, 1, true, uncacheVersionJob)
+	return gotv.printVersionJobsSummary(jobs, "uncached")
+}
+
+func uncacheVersionJob(gotv *GoTV, tv *toolchainVersion) error {
+	if err := gotv.normalizeToolchainVersion(tv, false); err != nil {
+		return err
+	}
+
+	var folder = tv.folderName()
+	var toolchainDir = filepath.Join(gotv.cacheDir, folder)
+	if _, err := os.Stat(toolchainDir); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(gotv.stdout, "Version %s is not cached.\n", tv)
+			return nil
+		}
+		return err
+	}
+
+	fmt.Fprintln(gotv.stdout, "[Run]: rm -rf", gotv.replaceHomeDir(toolchainDir))
+	if err := os.RemoveAll(toolchainDir); err != nil {
+		return err
+	}
+
+	// The isolated GOCACHE and GOMODCACHE of the version are useless now.
+	return gotv.removeGoCachesDir(filepath.Join(gotv.goCachesDir(), folder))
+}
+
+func (gotv *GoTV) pinVersion(version string) error {
+	var tv = parseGoToolchainVersion(version, true)
+	if invalid, message := tv.IsInvalid(); invalid {
+		return errors.New(message)
+	}
+	if tv.options.isCrossCompiled() {
+		return fmt.Errorf("toolchain %s is built for %s, it can't be pinned on this host", tv, tv.options.target())
+	}
+
+	var _, err = gotv.ensureToolchainVersion(&tv, true)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(gotv.stdout, `Pinned %s at %s.
+
+Please put the following shown pinned toolchain path in
+your PATH environment variable to use go commands directly:
+
+	%s
+
+`, tv, gotv.replaceHomeDir(gotv.pinnedToolchainDir), filepath.Join(gotv.pinnedToolchainDir, "bin"))
+
+	return nil
+}
+
+func (gotv *GoTV) unpinVersion() error {
+	if err := os.RemoveAll(gotv.pinnedToolchainDir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (gotv *GoTV) setDefaultVersion(version string) (err error) {
+	var tv = parseGoToolchainVersion(version, true)
+	if invalid, message := tv.IsInvalid(); invalid {
+		err = errors.New(message)
+		return
+	}
+
+	//gotv.repoInfo, err = collectRepositoryInfo(gotv.repositoryDir)
+	//if err != nil {
+	//	return
+	//}
+	//if err = gotv.normalizeToolchainVersion(&tv, true); err != nil {
+	//	return
+	//}
+
+	if tv.forceSyncRepo {
+		fmt.Fprintln(gotv.stdout, "The ! sign is ignored.")
+		tv.forceSyncRepo = false
+	}
+
+	if err = gotv.changeDefaultVersion(tv); err != nil {
+		return
+	}
+
+	fmt.Fprintf(gotv.stdout, "Default version is set as %s now.\n", tv)
+	return
+}
+
+func (gotv *GoTV) listDefaultEnvs() error {
+	config, err := gotv.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(config.VersionEnvs) == 0 {
+		fmt.Fprintln(gotv.stdout, "No default envs are set.")
+		return nil
+	}
+
+	var versions = make([]string, 0, len(config.VersionEnvs))
+	for v := range config.VersionEnvs {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+
+	for _, v := range versions {
+		fmt.Fprintf(gotv.stdout, "%s:\n", v)
+		for _, env := range config.VersionEnvs[v] {
+			fmt.Fprintf(gotv.stdout, "\t%s\n", env)
+		}
+	}
+	return nil
+}
+
+func (gotv *GoTV) setDefaultEnvs(version string, envs ...string) error {
+	var tv = parseGoToolchainVersion(version, true)
+	if invalid, message := tv.IsInvalid(); invalid {
+		return errors.New(message)
+	}
+
+	if tv.forceSyncRepo {
+		fmt.Fprintln(gotv.stdout, "The ! sign is ignored.")
+		tv.forceSyncRepo = false
+	}
+	if tv.options != (buildOptions{}) {
+		fmt.Fprintln(gotv.stdout, "The build options are ignored.")
+		tv.options = buildOptions{}
+	}
+
+	if len(envs) == 0 {
+		config, err := gotv.loadConfig()
+		if err != nil {
+			return err
+		}
+		if envs := config.VersionEnvs[versionEnvsKey(tv)]; len(envs) == 0 {
+			fmt.Fprintf(gotv.stdout, "No default envs are set for %s.\n", tv)
+		} else {
+			for _, env := range envs {
+				fmt.Fprintln(gotv.stdout, env)
+			}
+		}
+		return nil
+	}
+
+	if len(envs) == 1 && envs[0] == "-clear" {
+		envs = nil
+	} else {
+		for _, env := range envs {
+			if !isValidEnvSetting(env) {
+				return fmt.Errorf("invalid env setting %s (should be in the form of NAME=VALUE)", env)
+			}
+		}
+	}
+
+	if err := gotv.changeDefaultVersionEnvs(tv, envs); err != nil {
+		return err
+	}
+
+	if len(envs) == 0 {
+		fmt.Fprintf(gotv.stdout, "Default envs for %s are cleared.\n", tv)
+	} else {
+		fmt.Fprintf(gotv.stdout, "Default envs for %s are set as %s now.\n", tv, strings.Join(envs, " "))
+	}
+	return nil
+}
+
+func (gotv *GoTV) checkDefaultVersion() error {
+	tv := gotv.defaultVersion()
+	if invalid, _ := tv.IsInvalid(); invalid {
+		fmt.Fprintln(gotv.stdout, "Default version is not set.")
+	} else {
+		fmt.Fprintln(gotv.stdout, tv)
+	}
+	return nil
+}
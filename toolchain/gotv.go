@@ -0,0 +1,336 @@
+package toolchain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GoTV manages the toolchains built from the Go git repository
+// cloned in a cache directory. The zero value is not usable,
+// please call New to create GoTV values.
+type GoTV struct {
+	homeDir string
+
+	// Used to clone the Go git repository if it hasn't been cloned.
+	// If it is blank, it is asked from standard input.
+	repositoryURL string
+
+	// Never access the network (see Options.Offline).
+	offline bool
+
+	// Used to clone the Go git repository (see init-repo).
+	cloneOptions cloneOptions
+
+	// The context of the current API call (see withContext).
+	ctx context.Context
+
+	cacheDir           string
+	repositoryDir      string
+	pinnedToolchainDir string
+
+	repoInfo          repoInfo
+	versionGoCmdPaths map[toolchainVersion]string
+
+	verify verifyOptions // set by "cache-version -verify"
+
+	// The outputs of the processes of building toolchains.
+	// Toolchains might be built concurrently (see cacheVersion),
+	// in which case, each build has its own outputs.
+	stdout, stderr io.Writer
+	folderLocks    *folderLocks
+
+	// The user is asked for the repository address and ssh key files
+	// from it (if needed). It is nil if there is no interactive input.
+	stdin io.Reader
+
+	// Serializes the operations on the Go git repository, which is
+	// shared by concurrent builds and API calls (see lockRepository).
+	repoLock *sync.Mutex
+
+	// Receives the progress of syncing the repository and
+	// building toolchains. By default, it prints to stdout.
+	reporter Reporter
+
+	configDir      string
+	configFilePath string
+}
+
+type repoInfo struct {
+	releaseTags     map[string]string // simplified name to full tag name
+	allTags         map[string]string // tag name to hash hex
+	versionBranches map[string]string // simplified name to full branch name
+	allBranches     map[string]string // branch name to head hash hex
+	tipHash         string
+
+	tagDates map[string]time.Time // tag name to date (might be absent)
+}
+
+type configFile struct {
+	DefaultVersion string `json:"default-version"`
+
+	// version to NAME=VALUE items, used when running go commands.
+	VersionEnvs map[string][]string `json:"version-envs,omitempty"`
+
+	// See the default-caches command.
+	GoCachePolicy    string `json:"gocache-policy,omitempty"`
+	GoModCachePolicy string `json:"gomodcache-policy,omitempty"`
+
+	// See the fetch-interval command.
+	FetchInterval string `json:"fetch-interval,omitempty"`
+
+	// See the fetch-refspecs command.
+	FetchRefSpecs []string `json:"fetch-refspecs,omitempty"`
+
+	// See the mirrors command.
+	Mirrors       []string `json:"mirrors,omitempty"`
+	MirrorTimeout string   `json:"mirror-timeout,omitempty"`
+
+	// See the verify-tags command.
+	VerifyTags string `json:"verify-tags,omitempty"`
+	TagKeyring string `json:"tag-keyring,omitempty"`
+}
+
+func born() (_ GoTV, err error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err == nil {
+		configDir, _ = filepath.Abs(configDir)
+	}
+
+	return bornWithCacheAndConfigDir(cacheDir, configDir)
+}
+
+func bornWithCacheAndConfigDir(cacheDir, configDir string) (gotv GoTV, err error) {
+	gotv.homeDir, _ = os.UserHomeDir() // used to read user ssh key
+
+	gotv.repositoryDir = filepath.Join(cacheDir, "gotv", "the-repository")
+	gotv.cacheDir = filepath.Dir(gotv.repositoryDir)
+	gotv.pinnedToolchainDir = filepath.Join(gotv.cacheDir, "pinned-toolchain")
+
+	gotv.versionGoCmdPaths = make(map[toolchainVersion]string, 128)
+
+	gotv.stdin, gotv.stdout, gotv.stderr = os.Stdin, os.Stdout, os.Stderr
+	gotv.reporter = NewTerminalReporter(gotv.stdout)
+	gotv.folderLocks = &folderLocks{locks: make(map[string]*sync.Mutex)}
+	gotv.repoLock = &sync.Mutex{}
+
+	if configDir != "" {
+		gotv.configFilePath = filepath.Join(configDir, "gotv", "config.info")
+		gotv.configDir = filepath.Dir(gotv.configFilePath)
+	}
+
+	return
+}
+
+// userInput returns nil if there is no interactive input.
+func (gotv *GoTV) userInput() *userInput {
+	if gotv.stdin == nil {
+		return nil
+	}
+	return &userInput{in: gotv.stdin, out: gotv.stdout}
+}
+
+func (gotv *GoTV) context() context.Context {
+	if gotv.ctx == nil {
+		return context.Background()
+	}
+	return gotv.ctx
+}
+
+// withContext returns a copy of gotv used in an API call.
+// The copy has its own session state, so that API calls
+// are allowed to run concurrently.
+func (gotv *GoTV) withContext(ctx context.Context) *GoTV {
+	var fork = *gotv
+	fork.ctx = ctx
+	fork.repoInfo = repoInfo{}
+	fork.versionGoCmdPaths = make(map[toolchainVersion]string)
+	return &fork
+}
+
+// folderLocks prevent a toolchain folder from being built
+// by several concurrent builds.
+type folderLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (fl *folderLocks) lock(folder string) (unlock func()) {
+	fl.mu.Lock()
+	var m = fl.locks[folder]
+	if m == nil {
+		m = &sync.Mutex{}
+		fl.locks[folder] = m
+	}
+	fl.mu.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
+
+// lockRepository waits for the other operations on the Go git
+// repository (fetching, loading references, completing shallow and
+// partial clones, copying out source trees) to finish.
+func (gotv *GoTV) lockRepository() (unlock func()) {
+	gotv.repoLock.Lock()
+	return gotv.repoLock.Unlock
+}
+
+func (gotv *GoTV) replaceHomeDir(in string) string {
+	if gotv.homeDir == "" {
+		return in
+	}
+	if len(in) == len(gotv.homeDir) {
+		return in
+	}
+	if strings.HasPrefix(in, gotv.homeDir) && in[len(gotv.homeDir)] == filepath.Separator {
+		return "$HOME" + in[len(gotv.homeDir):]
+	}
+
+	return in
+}
+
+// expandHomeDir expands the leading ~ in a path.
+func expandHomeDir(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, path[1:])
+		}
+	}
+	return path
+}
+
+func (gotv *GoTV) toolchainVersion2Revision(tv toolchainVersion) string {
+	switch tv.kind {
+	case kind_Tag:
+		var rev, ok = gotv.repoInfo.allTags[tv.version]
+		if !ok {
+			panic("tag not found: " + tv.version)
+		}
+		return rev
+	case kind_Branch:
+		var rev, ok = gotv.repoInfo.allBranches[tv.version]
+		if !ok {
+			panic("branch not found: " + tv.version)
+		}
+		return rev
+	case kind_Revision:
+		return tv.version
+	case kind_Source:
+		var _, hash = splitSourceVersion(tv.version)
+		return hash
+	}
+
+	panic("unreachable")
+}
+
+func (gotv *GoTV) loadConfig() (config configFile, err error) {
+	if gotv.configFilePath == "" {
+		err = errors.New("Config path is undetermined.")
+		return
+	}
+
+	data, err := os.ReadFile(gotv.configFilePath)
+	if err != nil {
+		err = nil
+		return
+	} else {
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			return
+		}
+		err = json.Unmarshal(data, &config)
+	}
+	return
+}
+
+func (gotv *GoTV) defaultVersion() (tv toolchainVersion) {
+	var config, err = gotv.loadConfig()
+	if err != nil {
+		return
+	}
+
+	return parseGoToolchainVersion(config.DefaultVersion, true)
+}
+
+func (gotv *GoTV) saveConfig(config configFile) (err error) {
+	data, err := json.Marshal(&config)
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(gotv.configDir, 0700)
+	if err != nil {
+		return
+	}
+
+	err = os.WriteFile(gotv.configFilePath, data, 0644)
+	return
+}
+
+func (gotv *GoTV) changeDefaultVersion(tv toolchainVersion) (err error) {
+	config, err := gotv.loadConfig()
+	if err != nil {
+		return
+	}
+
+	config.DefaultVersion = tv.String()
+
+	return gotv.saveConfig(config)
+}
+
+// Default envs are keyed by versions without build options and the ! sign.
+func versionEnvsKey(tv toolchainVersion) string {
+	tv.forceSyncRepo = false
+	tv.options = buildOptions{}
+	return tv.String()
+}
+
+// defaultVersionEnvs returns the default envs set for both the
+// normalized form of a version and the version as specified.
+// The latter ones come later so that they take effect.
+func (gotv *GoTV) defaultVersionEnvs(specified, normalized toolchainVersion) ([]string, error) {
+	var config, err = gotv.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var envs []string
+	var specifiedKey, normalizedKey = versionEnvsKey(specified), versionEnvsKey(normalized)
+	if normalizedKey != specifiedKey {
+		envs = append(envs, config.VersionEnvs[normalizedKey]...)
+	}
+	envs = append(envs, config.VersionEnvs[specifiedKey]...)
+	return envs, nil
+}
+
+func (gotv *GoTV) changeDefaultVersionEnvs(tv toolchainVersion, envs []string) (err error) {
+	config, err := gotv.loadConfig()
+	if err != nil {
+		return
+	}
+
+	var key = versionEnvsKey(tv)
+	if len(envs) == 0 {
+		delete(config.VersionEnvs, key)
+	} else {
+		if config.VersionEnvs == nil {
+			config.VersionEnvs = make(map[string][]string)
+		}
+		config.VersionEnvs[key] = envs
+	}
+
+	return gotv.saveConfig(config)
+}
@@ -0,0 +1,252 @@
+package toolchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	gittransport "github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// The default timeout of probing a mirror of the Go git repository.
+const defaultMirrorTimeout = 30 * time.Second
+
+// originConfig is the config of fetching the origin remote.
+type originConfig struct {
+	RefSpecs []string      // see the fetch-refspecs command
+	Mirrors  []string      // see the mirrors command
+	Timeout  time.Duration // of probing each mirror, and the idle timeout of fetching
+}
+
+func (gotv *GoTV) originConfig() (origin originConfig) {
+	origin.Timeout = defaultMirrorTimeout
+	var config, err = gotv.loadConfig()
+	if err != nil {
+		return
+	}
+	origin.RefSpecs = config.FetchRefSpecs
+	origin.Mirrors = config.Mirrors
+	if d, err := time.ParseDuration(config.MirrorTimeout); err == nil && d > 0 {
+		origin.Timeout = d
+	}
+	return
+}
+
+// repositoryURLs returns the URLs tried in order to access the Go git
+// repository: the primary one (if it is not blank), then the mirrors.
+func repositoryURLs(primary string, mirrors []string) []string {
+	var urls = make([]string, 0, len(mirrors)+1)
+	var added = make(map[string]bool, len(mirrors)+1)
+	for _, url := range append([]string{primary}, mirrors...) {
+		if url != "" && !added[url] {
+			added[url] = true
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// gitListRefs lists the references in a remote repository.
+func gitListRefs(ctx context.Context, repoAddr string, auth gittransport.AuthMethod) ([]*plumbing.Reference, error) {
+	var remote = git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{repoAddr},
+	})
+	caBundle, err := gitCABundle()
+	if err != nil {
+		return nil, err
+	}
+	return remote.ListContext(ctx, &git.ListOptions{Auth: auth, CABundle: caBundle})
+}
+
+// tryRepositoryURLs calls f with the URLs (and their authentications,
+// which are resolved once per URL) in order until it succeeds. If there
+// are several URLs, each of them is probed (by listing its references
+// within the timeout) before f is called with it. The used URL is
+// reported, and it is returned with its authentication. originAddr is
+// the address of the origin remote (see gitAuth).
+//
+// The timeout is also the idle timeout of f: the context passed to f
+// is canceled if f makes no progress within it, so that a stalled URL
+// never blocks. The progress is shown by the events reported through
+// the report function passed to f, and by the growth of packDir, where
+// the received objects are written.
+func tryRepositoryURLs(ctx context.Context, urls []string, originAddr string, timeout time.Duration, packDir string, report func(Event), input *userInput, f func(ctx context.Context, url string, auth gittransport.AuthMethod, report func(Event)) error) (used string, auth gittransport.AuthMethod, err error) {
+	var reportMessage = func(format string, a ...interface{}) {
+		report(Event{Kind: EventMessage, Time: time.Now(), Message: fmt.Sprintf(format, a...)})
+	}
+	var call = func(url string, auth gittransport.AuthMethod) error {
+		var idleCtx, idleReport, stop = withIdleTimeout(ctx, timeout, packDir, report)
+		var err = f(idleCtx, url, auth, idleReport)
+		if stop() && err != nil && err != git.NoErrAlreadyUpToDate {
+			err = fmt.Errorf("no progress within %s: %w", timeout, err)
+		}
+		return err
+	}
+
+	if len(urls) == 1 {
+		if auth, err = gitAuth(urls[0], originAddr, input); err != nil {
+			return "", nil, err
+		}
+		auth, err = retryWithCredentialHelper(urls[0], auth, func(auth gittransport.AuthMethod) error {
+			return call(urls[0], auth)
+		})
+		if err == nil || err == git.NoErrAlreadyUpToDate {
+			reportMessage("Used repository address %s.", urls[0])
+		}
+		return urls[0], auth, err
+	}
+
+	var failures = make([]string, 0, len(urls))
+	for _, url := range urls {
+		auth, err = gitAuth(url, originAddr, input)
+		if err == nil {
+			var probeCtx, cancel = context.WithTimeout(ctx, timeout)
+			auth, err = retryWithCredentialHelper(url, auth, func(auth gittransport.AuthMethod) error {
+				_, err := gitListRefs(probeCtx, url, auth)
+				return err
+			})
+			cancel()
+		}
+		if err == nil {
+			err = call(url, auth)
+			if err == nil || err == git.NoErrAlreadyUpToDate {
+				reportMessage("Used repository address %s.", url)
+				return url, auth, err
+			}
+		}
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		reportMessage("Failed to use %s: %s", url, err)
+		failures = append(failures, url+": "+err.Error())
+	}
+	return "", nil, errors.New("all the repository addresses failed:\n\t" + strings.Join(failures, "\n\t"))
+}
+
+// withIdleTimeout returns a context which is canceled if there is no
+// progress within the timeout (if it is positive). The progress is
+// shown by the events reported through the returned report function
+// (which forwards them to report), and by the growth of the size of
+// dir (if it is not blank). The returned stop function releases the
+// resources and reports whether or not the context was canceled for
+// being idle.
+func withIdleTimeout(ctx context.Context, timeout time.Duration, dir string, report func(Event)) (context.Context, func(Event), func() (idled bool)) {
+	ctx, cancel := context.WithCancel(ctx)
+	if timeout <= 0 {
+		return ctx, report, func() bool {
+			cancel()
+			return false
+		}
+	}
+
+	var mu sync.Mutex
+	var last = time.Now()
+	var idled bool
+	var done = make(chan struct{})
+	go func() {
+		var interval = timeout / 4
+		if interval > time.Second {
+			interval = time.Second
+		}
+		var ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+		var size = dirSize(dir)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			mu.Lock()
+			if dir != "" {
+				if s := dirSize(dir); s != size {
+					size, last = s, time.Now()
+				}
+			}
+			if time.Since(last) >= timeout {
+				idled = true
+				mu.Unlock()
+				cancel()
+				return
+			}
+			mu.Unlock()
+		}
+	}()
+
+	var idleReport = func(e Event) {
+		mu.Lock()
+		last = time.Now()
+		mu.Unlock()
+		report(e)
+	}
+	var stop = func() bool {
+		close(done)
+		cancel()
+		mu.Lock()
+		defer mu.Unlock()
+		return idled
+	}
+	return ctx, idleReport, stop
+}
+
+// setMirrors implements the mirrors command, which shows or sets
+// the mirrors of the Go git repository and the timeout of probing
+// each of them.
+func (gotv *GoTV) setMirrors(args ...string) error {
+	var flags = newFlagSet("mirrors")
+	var timeout = flags.Duration("timeout", 0, "")
+	var clear = flags.Bool("clear", false, "")
+	urls, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if *clear && len(urls) > 0 {
+		return errors.New(`mirrors -clear needs no URLs`)
+	}
+	if *timeout < 0 {
+		return errors.New(`the -timeout option of mirrors must not be negative`)
+	}
+
+	config, err := gotv.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if len(config.Mirrors) == 0 {
+			fmt.Fprintln(gotv.stdout, "No mirrors are set.")
+		} else {
+			fmt.Fprintln(gotv.stdout, "Mirrors (tried in order after origin):")
+			for _, url := range config.Mirrors {
+				fmt.Fprintf(gotv.stdout, "\t%s\n", gotv.replaceHomeDir(url))
+			}
+		}
+		var d = defaultMirrorTimeout.String()
+		if config.MirrorTimeout != "" {
+			d = config.MirrorTimeout
+		}
+		fmt.Fprintf(gotv.stdout, "Timeout of probing each mirror: %s\n", d)
+		return nil
+	}
+
+	if *timeout > 0 {
+		config.MirrorTimeout = timeout.String()
+		fmt.Fprintf(gotv.stdout, "Timeout of probing each mirror is set as %s now.\n", timeout)
+	}
+	if *clear {
+		config.Mirrors = nil
+		fmt.Fprintln(gotv.stdout, "Mirrors are cleared.")
+	} else if len(urls) > 0 {
+		config.Mirrors = urls
+		fmt.Fprintln(gotv.stdout, "Mirrors are set now.")
+	}
+	return gotv.saveConfig(config)
+}
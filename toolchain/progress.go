@@ -0,0 +1,292 @@
+package toolchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An EventKind is the kind of an Event.
+type EventKind string
+
+const (
+	// A phase, such as clone, fetch, checkout and build, starts.
+	EventPhaseStarted EventKind = "phase-started"
+
+	// A phase finishes. The Duration, Bytes and Error fields are set.
+	EventPhaseFinished EventKind = "phase-finished"
+
+	// The progress of a phase, such as "Counting objects" (with the
+	// Current and Total fields set) reported by git servers.
+	EventProgress EventKind = "progress"
+
+	// A line output by the toolchain build script.
+	EventBuildStep EventKind = "build-step"
+
+	// A command is run, such as "git fetch" and "make.bash".
+	EventCommand EventKind = "command"
+
+	// A message for users, such as which mirror of the Go git
+	// repository is used.
+	EventMessage EventKind = "message"
+)
+
+// Event phases.
+const (
+	PhaseClone    = "clone"
+	PhaseFetch    = "fetch"
+	PhaseCheckout = "checkout"
+	PhasePatch    = "patch"
+	PhaseBuild    = "build"
+)
+
+// An Event reports the progress of syncing the Go git repository
+// and building toolchains.
+type Event struct {
+	Kind    EventKind `json:"kind"`
+	Time    time.Time `json:"time"`
+	Phase   string    `json:"phase,omitempty"`
+	Version string    `json:"version,omitempty"` // the toolchain version being built
+	Message string    `json:"message,omitempty"`
+
+	Current int64 `json:"current,omitempty"`
+	Total   int64 `json:"total,omitempty"`
+
+	// The number of bytes fetched in a clone or fetch phase.
+	Bytes int64 `json:"bytes,omitempty"`
+
+	Duration time.Duration `json:"duration,omitempty"` // in nanoseconds in JSON
+	Error    string        `json:"error,omitempty"`
+}
+
+// A Reporter receives progress events. The Report method
+// might be called concurrently when several toolchains are
+// built in parallel.
+type Reporter interface {
+	Report(Event)
+}
+
+func (gotv *GoTV) report(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	gotv.reporter.Report(e)
+}
+
+// reportCommand reports a command, which is printed as a [Run] line
+// by the terminal reporter.
+func (gotv *GoTV) reportCommand(version string, args ...string) {
+	gotv.report(Event{Kind: EventCommand, Version: version, Message: strings.Join(args, " ")})
+}
+
+// eventVersion returns the version shown in the events of
+// building the toolchain of a version.
+func eventVersion(tv toolchainVersion) string {
+	tv.forceSyncRepo = false
+	return tv.String()
+}
+
+// startPhase reports the start of a phase. The returned function
+// reports the finish of the phase.
+func startPhase(report func(Event), phase, version, message string) (finish func(bytes int64, err error)) {
+	var start = time.Now()
+	report(Event{Kind: EventPhaseStarted, Time: start, Phase: phase, Version: version, Message: message})
+	return func(bytes int64, err error) {
+		var e = Event{
+			Kind:     EventPhaseFinished,
+			Time:     time.Now(),
+			Phase:    phase,
+			Version:  version,
+			Message:  message,
+			Bytes:    bytes,
+			Duration: time.Since(start),
+		}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		report(e)
+	}
+}
+
+// eventLineWriter calls a function for each line written to it.
+// Both '\n' and '\r' end lines.
+type eventLineWriter struct {
+	handle func(line string)
+	buf    []byte
+}
+
+func (lw *eventLineWriter) Write(p []byte) (int, error) {
+	var n = len(p)
+	for len(p) > 0 {
+		i := bytes.IndexAny(p, "\r\n")
+		if i < 0 {
+			lw.buf = append(lw.buf, p...)
+			break
+		}
+		lw.buf = append(lw.buf, p[:i]...)
+		p = p[i+1:]
+		lw.flushLine()
+	}
+	return n, nil
+}
+
+// Flush handles the current incomplete line, if it exists.
+func (lw *eventLineWriter) Flush() {
+	lw.flushLine()
+}
+
+func (lw *eventLineWriter) flushLine() {
+	var line = strings.TrimRight(string(lw.buf), " \t")
+	lw.buf = lw.buf[:0]
+	if line != "" {
+		lw.handle(line)
+	}
+}
+
+// For example, "Counting objects:  45% (123/456)".
+var gitProgressRegexp = regexp.MustCompile(`^(.*):\s+\d+% \((\d+)/(\d+)\)`)
+
+// newGitProgressWriter returns a writer used as the Progress of
+// go-git clone and fetch options. It reports the progress lines
+// sent by git servers as progress events.
+func newGitProgressWriter(report func(Event), phase string) *eventLineWriter {
+	return &eventLineWriter{handle: func(line string) {
+		var e = Event{Kind: EventProgress, Time: time.Now(), Phase: phase, Message: line}
+		if ms := gitProgressRegexp.FindStringSubmatch(line); ms != nil {
+			e.Message = ms[1]
+			e.Current, _ = strconv.ParseInt(ms[2], 10, 64)
+			e.Total, _ = strconv.ParseInt(ms[3], 10, 64)
+		}
+		report(e)
+	}}
+}
+
+// dirSize returns the total size of the files in a directory.
+// It is used to calculate how many bytes are fetched.
+func dirSize(dir string) (size int64) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// NewJSONReporter returns a Reporter which writes events
+// to w as JSON lines. It is suitable for CI logs.
+func NewJSONReporter(w io.Writer) Reporter {
+	return &jsonReporter{w: w}
+}
+
+type jsonReporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (r *jsonReporter) Report(e Event) {
+	var data, err = json.Marshal(e)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.w.Write(data)
+}
+
+// NewTerminalReporter returns a Reporter which prints events to w
+// for humans. Commands are printed as [Run] lines and build steps
+// are printed as they are. If w is a terminal, the progress of
+// git servers is shown as a progress bar.
+func NewTerminalReporter(w io.Writer) Reporter {
+	return &terminalReporter{w: w, isTerminal: isTerminal(w)}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&fs.ModeCharDevice != 0
+}
+
+type terminalReporter struct {
+	mu         sync.Mutex
+	w          io.Writer
+	isTerminal bool
+	barShown   bool // whether or not the current line is a progress bar
+}
+
+const progressBarWidth = 30
+
+func (r *terminalReporter) Report(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e.Kind == EventProgress {
+		if r.isTerminal {
+			r.showProgressBar(e)
+		}
+		return
+	}
+
+	if r.barShown {
+		fmt.Fprint(r.w, "\r\033[K")
+		r.barShown = false
+	}
+
+	switch e.Kind {
+	case EventCommand:
+		fmt.Fprintln(r.w, "[Run]:", e.Message)
+	case EventBuildStep, EventMessage:
+		fmt.Fprintln(r.w, e.Message)
+	case EventPhaseFinished:
+		if e.Error != "" {
+			break
+		}
+		if e.Bytes > 0 {
+			fmt.Fprintf(r.w, "Received %s in %s.\n", formatBytes(e.Bytes), e.Duration.Round(time.Millisecond))
+		}
+		if e.Phase == PhaseBuild {
+			fmt.Fprintln(r.w)
+		}
+	}
+}
+
+func (r *terminalReporter) showProgressBar(e Event) {
+	var line = e.Message
+	if e.Total > 0 && e.Current <= e.Total {
+		var done = int(e.Current * progressBarWidth / e.Total)
+		line = fmt.Sprintf("%-24s [%s%s] %3d%% (%d/%d)", e.Message,
+			strings.Repeat("#", done), strings.Repeat(" ", progressBarWidth-done),
+			e.Current*100/e.Total, e.Current, e.Total)
+	}
+	fmt.Fprint(r.w, "\r\033[K", line)
+	r.barShown = true
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,174 @@
+package toolchain
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The index file is in the .git directory of the repository,
+// so that it is removed along with the repository.
+const repositoryIndexFile = "gotv-index.info"
+
+// Increase it when the format of the index is changed.
+const repositoryIndexFormat = 1
+
+// repositoryIndex is a persistent index of the tags and branches in
+// the repository, so that the references are not scanned on every run.
+type repositoryIndex struct {
+	Format   int                   `json:"format"`
+	Stamp    refsStamp             `json:"stamp"`
+	Tags     map[string]indexedRef `json:"tags"`
+	Branches map[string]indexedRef `json:"branches"`
+}
+
+type indexedRef struct {
+	Hash string    `json:"hash"`
+	Date time.Time `json:"date,omitempty"` // for tags only
+
+	// The simplified name of a release tag or a version branch.
+	Release string `json:"release,omitempty"`
+}
+
+// A refsStamp changes when the references in a repository are changed.
+// It consists of the modification time and size of the packed-refs file,
+// and the latest modification time and number of the loose references
+// (and their directories, whose modification times change when
+// references are removed).
+type refsStamp struct {
+	PackedRefsTime int64 `json:"packed-refs-time"`
+	PackedRefsSize int64 `json:"packed-refs-size"`
+	LooseRefsTime  int64 `json:"loose-refs-time"`
+	LooseRefsCount int   `json:"loose-refs-count"`
+}
+
+func repositoryRefsStamp(repoDir string) (stamp refsStamp, err error) {
+	var gitDir = filepath.Join(repoDir, ".git")
+	if info, err := os.Stat(filepath.Join(gitDir, "packed-refs")); err == nil {
+		stamp.PackedRefsTime = info.ModTime().UnixNano()
+		stamp.PackedRefsSize = info.Size()
+	} else if !os.IsNotExist(err) {
+		return stamp, err
+	}
+
+	err = filepath.WalkDir(filepath.Join(gitDir, "refs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if t := info.ModTime().UnixNano(); t > stamp.LooseRefsTime {
+			stamp.LooseRefsTime = t
+		}
+		if !d.IsDir() {
+			stamp.LooseRefsCount++
+		}
+		return nil
+	})
+	return
+}
+
+func repositoryIndexPath(repoDir string) string {
+	return filepath.Join(repoDir, ".git", repositoryIndexFile)
+}
+
+// loadRepositoryIndex loads the index of the repository, and
+// rebuilds it if the references in the repository are changed.
+func loadRepositoryIndex(repoDir string) (index repositoryIndex, err error) {
+	stamp, err := repositoryRefsStamp(repoDir)
+	if err != nil {
+		return
+	}
+
+	index = readRepositoryIndex(repoDir)
+	if index.Format == repositoryIndexFormat && index.Stamp == stamp {
+		return index, nil
+	}
+
+	return updateRepositoryIndex(repoDir, index)
+}
+
+// readRepositoryIndex reads the index file of the repository,
+// without checking whether or not it is stale.
+func readRepositoryIndex(repoDir string) (index repositoryIndex) {
+	data, err := os.ReadFile(repositoryIndexPath(repoDir))
+	if err != nil || json.Unmarshal(data, &index) != nil {
+		return repositoryIndex{}
+	}
+	return index
+}
+
+// refreshRepositoryIndex rebuilds the index of the repository after
+// it is cloned or fetched, in case the modification times of the
+// references are too coarse to detect the changes.
+func refreshRepositoryIndex(repoDir string) error {
+	_, err := updateRepositoryIndex(repoDir, readRepositoryIndex(repoDir))
+	return err
+}
+
+// updateRepositoryIndex rebuilds the index of the repository.
+// The dates of the unchanged tags in the old index are reused.
+func updateRepositoryIndex(repoDir string, old repositoryIndex) (index repositoryIndex, err error) {
+	// Get the stamp before listing the references, so that the
+	// references changed in between make the index stale.
+	index.Stamp, err = repositoryRefsStamp(repoDir)
+	if err != nil {
+		return
+	}
+
+	tags, branches, err := gitListTagsAndRemoteBranches(repoDir)
+	if err != nil {
+		return
+	}
+
+	var newTags = make(map[string]string, 32)
+	index.Format = repositoryIndexFormat
+	index.Tags = make(map[string]indexedRef, len(tags))
+	for t, hash := range tags {
+		var ref = indexedRef{Hash: hash, Release: releaseOfTag(t)}
+		if oldRef, ok := old.Tags[t]; ok && oldRef.Hash == hash {
+			ref.Date = oldRef.Date
+		} else {
+			newTags[t] = hash
+		}
+		index.Tags[t] = ref
+	}
+
+	dates, err := gitTagDates(repoDir, newTags)
+	if err != nil {
+		return
+	}
+	for t, date := range dates {
+		var ref = index.Tags[t]
+		ref.Date = date
+		index.Tags[t] = ref
+	}
+
+	index.Branches = make(map[string]indexedRef, len(branches))
+	for b, hash := range branches {
+		index.Branches[b] = indexedRef{Hash: hash, Release: releaseOfBranch(b)}
+	}
+
+	// Failing to save the index is not fatal.
+	if data, err := json.Marshal(&index); err == nil {
+		var path = repositoryIndexPath(repoDir)
+		if f, err := os.CreateTemp(filepath.Dir(path), repositoryIndexFile+".*"); err == nil {
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = os.Rename(f.Name(), path)
+			}
+			if err != nil {
+				os.Remove(f.Name())
+			}
+		}
+	}
+
+	return index, nil
+}
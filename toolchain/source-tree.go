@@ -0,0 +1,290 @@
+package toolchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go101.org/gotv/internal/util"
+)
+
+// sourceInfo is recorded in the gotv.info files of
+// toolchains built from local Go source trees.
+type sourceInfo struct {
+	Dir      string `json:"dir"`
+	Revision string `json:"revision,omitempty"` // HEAD, if the tree is a git worktree
+	Dirty    bool   `json:"dirty,omitempty"`    // has uncommitted changes
+	Hash     string `json:"hash"`
+}
+
+// The top entries which are not parts of the source.
+var sourceTreeExcludedEntries = map[string]bool{
+	".git": true,
+	"bin":  true,
+	"pkg":  true,
+}
+
+// hashSourceTree computes the content hash of a local Go source tree.
+//
+// If the tree is a git worktree (and the git command is available),
+// the hash is computed from the HEAD revision and the changed files,
+// otherwise, it is computed from all the files in the tree.
+func hashSourceTree(dir string) (info sourceInfo, err error) {
+	if _, err = os.Stat(filepath.Join(dir, "src", "runtime")); err != nil {
+		err = fmt.Errorf("%s is not a Go source tree: %w", dir, err)
+		return
+	}
+	info.Dir = dir
+
+	var h = sha256.New()
+	if revision, changes, ok := gitSourceTreeState(dir); ok {
+		info.Revision = revision
+		info.Dirty = len(changes) > 0
+		fmt.Fprintf(h, "revision %s\n", revision)
+		for _, path := range changes {
+			if err = hashSourceFile(h, dir, path); err != nil {
+				return
+			}
+		}
+	} else {
+		err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == dir {
+				return nil
+			}
+			if filepath.Dir(path) == dir && sourceTreeExcludedEntries[d.Name()] {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			return hashSourceFile(h, dir, filepath.ToSlash(path[len(dir)+1:]))
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	info.Hash = hex.EncodeToString(h.Sum(nil))[:sourceHashLength]
+	return
+}
+
+// Removed files are also hashed, by their names.
+func hashSourceFile(h io.Writer, dir, path string) error {
+	var fullPath = filepath.Join(dir, filepath.FromSlash(path))
+	info, err := os.Lstat(fullPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(h, "removed %s\n", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "symlink %s %s\n", path, target)
+	case info.IsDir():
+		fmt.Fprintf(h, "dir %s\n", path)
+	default:
+		data, err := os.ReadFile(fullPath)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "file %s %o %d\n", path, info.Mode().Perm()&0111, len(data))
+		h.Write(data)
+	}
+	return nil
+}
+
+// gitSourceTreeState returns the HEAD revision and the sorted paths
+// of the changed and untracked files of a git worktree.
+// ok is false if dir is not a git worktree or git is unavailable.
+func gitSourceTreeState(dir string) (revision string, changes []string, ok bool) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return
+	}
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return
+	}
+
+	output, err := util.RunShellCommand(time.Minute, dir, nil, nil, nil, nil, gitPath, "rev-parse", "HEAD")
+	if err != nil {
+		return
+	}
+	revision = string(bytes.TrimSpace(output))
+
+	output, err = util.RunShellCommand(time.Minute, dir, nil, nil, nil, nil, gitPath, "status", "--porcelain", "-z", "--untracked-files=all")
+	if err != nil {
+		return
+	}
+	var entries = strings.Split(string(output), "\x00")
+	for i := 0; i < len(entries); i++ {
+		var entry = entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		changes = append(changes, entry[3:])
+		if entry[0] == 'R' || entry[0] == 'C' {
+			i++ // skip the original path
+			if i < len(entries) {
+				changes = append(changes, entries[i])
+			}
+		}
+	}
+	sort.Strings(changes)
+
+	return revision, changes, true
+}
+
+// copySourceTree copies a local Go source tree into a toolchain folder.
+// The .git directory is not copied, so a VERSION file is generated
+// for the copy if there is not one.
+func (gotv *GoTV) copySourceTree(tv toolchainVersion, toDir string) (info sourceInfo, err error) {
+	var dir, hash = splitSourceVersion(tv.version)
+	if info, err = hashSourceTree(dir); err != nil {
+		return
+	}
+	if info.Hash != hash {
+		err = fmt.Errorf("source tree %s is changed since %s, please retry", dir, tv)
+		return
+	}
+
+	var finish = startPhase(gotv.report, PhaseCheckout, eventVersion(tv), dir)
+	defer func() {
+		finish(0, err)
+	}()
+
+	gotv.reportCommand(eventVersion(tv), "cp -r", gotv.replaceHomeDir(dir), gotv.replaceHomeDir(toDir))
+	if err = os.MkdirAll(toDir, 0755); err != nil {
+		return
+	}
+
+	// Only the files covered by the hash are copied. For a git
+	// worktree, the ignored files (such as build outputs) are not.
+	if info.Revision != "" {
+		var paths []string
+		if paths, err = gitSourceTreeFiles(dir); err != nil {
+			return
+		}
+		for _, path := range paths {
+			if err = copySourceFile(dir, toDir, path); err != nil {
+				return
+			}
+		}
+		err = writeSourceVersionFile(toDir, info)
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if sourceTreeExcludedEntries[e.Name()] {
+			continue
+		}
+		var from, to = filepath.Join(dir, e.Name()), filepath.Join(toDir, e.Name())
+		if e.IsDir() {
+			err = util.CopyDir(from, to)
+		} else {
+			err = util.CopyFile(from, to)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	err = writeSourceVersionFile(toDir, info)
+	return
+}
+
+// writeSourceVersionFile generates the VERSION file
+// of a copied source tree if there is not one.
+func writeSourceVersionFile(toDir string, info sourceInfo) error {
+	var versionFile = filepath.Join(toDir, "VERSION")
+	if _, err := os.Stat(versionFile); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var version = "devel src-" + info.Hash
+	if info.Revision != "" {
+		version = "devel " + info.Revision[:12]
+		if info.Dirty {
+			version += "-dirty-" + info.Hash
+		}
+	}
+	return os.WriteFile(versionFile, []byte(version+"\n"), 0644)
+}
+
+// gitSourceTreeFiles returns the paths of the tracked files and the
+// untracked (but not ignored) files of a git worktree, which are the
+// files covered by the hash of the tree.
+func gitSourceTreeFiles(dir string) ([]string, error) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return nil, err
+	}
+	output, err := util.RunShellCommand(time.Minute, dir, nil, nil, nil, nil, gitPath, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, fmt.Errorf("list the files of source tree %s: %w", dir, err)
+	}
+	var paths []string
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path == "" {
+			continue
+		}
+		var top = path
+		if i := strings.IndexByte(path, '/'); i >= 0 {
+			top = path[:i]
+		}
+		if sourceTreeExcludedEntries[top] {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// copySourceFile copies a file (or a symlink) in a source tree.
+// The tracked files which have been removed are skipped.
+func copySourceFile(dir, toDir, path string) error {
+	var from, to = filepath.Join(dir, filepath.FromSlash(path)), filepath.Join(toDir, filepath.FromSlash(path))
+	info, err := os.Lstat(from)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(from)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, to)
+	}
+	return util.CopyFile(from, to)
+}
@@ -0,0 +1,337 @@
+package toolchain
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Tag verification methods (see the verify-tags command).
+const (
+	tagVerification_Signature = "signature" // signed annotated tags
+	tagVerification_Pinned    = "pinned"    // pinned release commits
+)
+
+// tagVerificationInfo is recorded in the gotv.info files
+// of the toolchains built from verified tags.
+type tagVerificationInfo struct {
+	Method string `json:"method"`
+	Commit string `json:"commit"`
+	Signer string `json:"signer,omitempty"` // for the signature method
+	Time   string `json:"time"`
+}
+
+// The pinned release commits are recorded by the record-release-commits
+// command in this file in the config dir, one "TAG COMMIT" pair per line.
+const releaseCommitsFile = "release-commits.txt"
+
+// parseReleaseCommits parses "TAG COMMIT" lines.
+// Blank lines and lines starting with # are ignored.
+func parseReleaseCommits(r io.Reader, commits map[string]string) error {
+	var scanner = bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		var line = strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var fields = strings.Fields(line)
+		if len(fields) != 2 || !isFullRevision(fields[1]) {
+			return fmt.Errorf("line %d: should be TAG COMMIT", n)
+		}
+		commits[fields[0]] = fields[1]
+	}
+	return scanner.Err()
+}
+
+func (gotv *GoTV) releaseCommitsPath() string {
+	return filepath.Join(gotv.configDir, releaseCommitsFile)
+}
+
+// pinnedReleaseCommits returns the release commits recorded in
+// the config dir.
+func (gotv *GoTV) pinnedReleaseCommits() (map[string]string, error) {
+	var commits = make(map[string]string, 256)
+	if gotv.configDir != "" {
+		f, err := os.Open(gotv.releaseCommitsPath())
+		if err == nil {
+			err = parseReleaseCommits(f, commits)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", gotv.replaceHomeDir(gotv.releaseCommitsPath()), err)
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return commits, nil
+}
+
+// tagVerificationMethod returns the method set by the verify-tags
+// command. It returns blank if tags are not verified.
+func (gotv *GoTV) tagVerificationMethod() (method, keyring string) {
+	var config, err = gotv.loadConfig()
+	if err != nil {
+		return "", ""
+	}
+	return config.VerifyTags, config.TagKeyring
+}
+
+// tagVerificationOutdated reports whether or not the toolchain built
+// from a tag needs to be verified (again) with the current method.
+func (gotv *GoTV) tagVerificationOutdated(tv toolchainVersion, info toolchainInfo) bool {
+	if tv.kind != kind_Tag {
+		return false
+	}
+	var method, _ = gotv.tagVerificationMethod()
+	return method != "" && (info.TagVerification == nil || info.TagVerification.Method != method)
+}
+
+// verifyTag verifies a tag in the repository with the method set by
+// the verify-tags command, so that tampered tags served by mirrors
+// are not built. It returns nil if tags are not verified.
+func (gotv *GoTV) verifyTag(tag string) (*tagVerificationInfo, error) {
+	var method, keyring = gotv.tagVerificationMethod()
+	if method == "" {
+		return nil, nil
+	}
+
+	defer gotv.lockRepository()()
+	repo, err := git.PlainOpen(gotv.repositoryDir)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := repo.Tag(tag)
+	if err != nil {
+		return nil, fmt.Errorf("tag %s: %w", tag, err)
+	}
+
+	var info = tagVerificationInfo{Method: method, Time: time.Now().UTC().Format(time.RFC3339)}
+	tagObject, err := repo.TagObject(ref.Hash())
+	switch {
+	case err == nil:
+		commit, err := tagObject.Commit()
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", tag, err)
+		}
+		info.Commit = commit.Hash.String()
+	case err == plumbing.ErrObjectNotFound:
+		tagObject = nil // a lightweight tag
+		info.Commit = ref.Hash().String()
+	default:
+		return nil, fmt.Errorf("tag %s: %w", tag, err)
+	}
+
+	switch method {
+	case tagVerification_Signature:
+		if tagObject == nil {
+			return nil, fmt.Errorf("tag %s is not an annotated tag, so it is not signed", tag)
+		}
+		if tagObject.PGPSignature == "" {
+			return nil, fmt.Errorf("tag %s is not signed", tag)
+		}
+		data, err := os.ReadFile(keyring)
+		if err != nil {
+			return nil, fmt.Errorf("read keyring: %w", err)
+		}
+		entity, err := tagObject.Verify(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("the signature of tag %s is invalid: %w", tag, err)
+		}
+		var names = make([]string, 0, len(entity.Identities))
+		for name := range entity.Identities {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		info.Signer = strings.Join(append([]string{entity.PrimaryKey.KeyIdString()}, names...), " ")
+	case tagVerification_Pinned:
+		commits, err := gotv.pinnedReleaseCommits()
+		if err != nil {
+			return nil, err
+		}
+		pinned, ok := commits[tag]
+		if !ok {
+			return nil, fmt.Errorf("the commit of tag %s is not pinned (see the record-release-commits command)", tag)
+		}
+		if pinned != info.Commit {
+			return nil, fmt.Errorf("tag %s points to commit %s, but the pinned official one is %s (the tag might be tampered)", tag, info.Commit, pinned)
+		}
+	default:
+		return nil, fmt.Errorf("unknown tag verification method: %s", method)
+	}
+	return &info, nil
+}
+
+// setTagVerification implements the verify-tags command.
+func (gotv *GoTV) setTagVerification(args ...string) error {
+	var flags = newFlagSet("verify-tags")
+	var keyring = flags.String("keyring", "", "")
+	rest, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 1 {
+		return errors.New(`verify-tags needs at most one non-option argument`)
+	}
+
+	config, err := gotv.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(rest) == 0 {
+		switch config.VerifyTags {
+		case "":
+			fmt.Fprintln(gotv.stdout, "Tags are not verified.")
+		case tagVerification_Signature:
+			fmt.Fprintf(gotv.stdout, "Tags must be signed by the keys in %s.\n", gotv.replaceHomeDir(config.TagKeyring))
+		default:
+			fmt.Fprintln(gotv.stdout, "Tags must point to the pinned official release commits.")
+		}
+		return nil
+	}
+
+	switch method := rest[0]; method {
+	case "off":
+		config.VerifyTags, config.TagKeyring = "", ""
+		fmt.Fprintln(gotv.stdout, "Tags will not be verified.")
+	case tagVerification_Signature:
+		if *keyring == "" {
+			return errors.New(`verify-tags signature needs the -keyring option (an armored public key file)`)
+		}
+		path, err := filepath.Abs(*keyring)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+		config.VerifyTags, config.TagKeyring = method, path
+		fmt.Fprintf(gotv.stdout, "Tags must be signed by the keys in %s now.\n", gotv.replaceHomeDir(path))
+	case tagVerification_Pinned:
+		config.VerifyTags, config.TagKeyring = method, ""
+		fmt.Fprintln(gotv.stdout, "Tags must point to the pinned official release commits now.")
+	default:
+		return fmt.Errorf("invalid tag verification method: %s (should be one of off, signature and pinned)", method)
+	}
+	return gotv.saveConfig(config)
+}
+
+// officialRepositoryURLs are the addresses of the official Go git
+// repository. Release commits are only recorded from them.
+var officialRepositoryURLs = []string{
+	"https://go.googlesource.com/go",
+	"https://github.com/golang/go",
+	"https://github.com/golang/go.git",
+}
+
+func isOfficialRepositoryURL(url string) bool {
+	url = strings.TrimSuffix(url, "/")
+	for _, official := range officialRepositoryURLs {
+		if url == official {
+			return true
+		}
+	}
+	return false
+}
+
+// recordReleaseCommits implements the record-release-commits command,
+// which records the commits of the release tags in the repository as
+// pinned ones. The origin remote of the repository must be one of the
+// official repository addresses. The already pinned commits are never
+// changed.
+func (gotv *GoTV) recordReleaseCommits(args ...string) error {
+	if len(args) > 0 {
+		return errors.New(`record-release-commits needs no arguments`)
+	}
+	if gotv.configDir == "" {
+		return errors.New("Config path is undetermined.")
+	}
+
+	if !gotv.repositoryExists() {
+		return errors.New("the Go git repository doesn't exist")
+	}
+	repo, err := git.PlainOpen(gotv.repositoryDir)
+	if err != nil {
+		return err
+	}
+	origin, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return fmt.Errorf("the origin remote of the Go git repository: %w", err)
+	}
+	if url := origin.Config().URLs[0]; !isOfficialRepositoryURL(url) {
+		return fmt.Errorf("the origin remote of the Go git repository is %s, release commits are only recorded from one of %s", url, strings.Join(officialRepositoryURLs, ", "))
+	}
+	repoInfo, err := gotv.loadRepositoryInfo(false)
+	if err != nil {
+		return err
+	}
+
+	pinned, err := gotv.pinnedReleaseCommits()
+	if err != nil {
+		return err
+	}
+
+	var tags = make([]string, 0, len(repoInfo.releaseTags))
+	for _, tag := range repoInfo.releaseTags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	var lines []string
+	var conflicts int
+	for _, tag := range tags {
+		ref, err := repo.Tag(tag)
+		if err != nil {
+			return fmt.Errorf("tag %s: %w", tag, err)
+		}
+		var commit = ref.Hash().String()
+		if tagObject, err := repo.TagObject(ref.Hash()); err == nil {
+			c, err := tagObject.Commit()
+			if err != nil {
+				return fmt.Errorf("tag %s: %w", tag, err)
+			}
+			commit = c.Hash.String()
+		}
+
+		if old, ok := pinned[tag]; ok {
+			if old != commit {
+				conflicts++
+				fmt.Fprintf(gotv.stderr, "Tag %s points to %s, but the pinned commit is %s.\n", tag, commit, old)
+			}
+			continue
+		}
+		lines = append(lines, tag+" "+commit+"\n")
+	}
+
+	if len(lines) > 0 {
+		if err := os.MkdirAll(gotv.configDir, 0700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(gotv.releaseCommitsPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, strings.Join(lines, ""))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(gotv.stdout, "%d release commits are recorded in %s.\n", len(lines), gotv.replaceHomeDir(gotv.releaseCommitsPath()))
+
+	if conflicts > 0 {
+		return fmt.Errorf("%d release tags don't point to the pinned commits", conflicts)
+	}
+	return nil
+}
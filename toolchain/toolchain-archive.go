@@ -0,0 +1,278 @@
+package toolchain
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go101.org/gotv/internal/util"
+)
+
+// The top directory in toolchain archives, the same as
+// the official Go distribution archives.
+const archiveTopDir = "go"
+
+func isZipArchive(archivePath string) (bool, error) {
+	switch name := strings.ToLower(archivePath); {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return false, nil
+	case strings.HasSuffix(name, ".zip"):
+		return true, nil
+	}
+	return false, fmt.Errorf("unsupported archive format: %s (should be .tar.gz, .tgz or .zip)", archivePath)
+}
+
+func (gotv *GoTV) writeToolchainArchive(toolchainDir, archivePath string) (err error) {
+	isZip, err := isZipArchive(archivePath)
+	if err != nil {
+		return err
+	}
+
+	if isZip {
+		fmt.Fprintln(gotv.stdout, "[Run]: zip -r", gotv.replaceHomeDir(archivePath), gotv.replaceHomeDir(toolchainDir))
+	} else {
+		fmt.Fprintln(gotv.stdout, "[Run]: tar -czf", gotv.replaceHomeDir(archivePath), "-C", gotv.replaceHomeDir(toolchainDir), ".")
+	}
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			os.Remove(archivePath)
+		}
+	}()
+
+	if isZip {
+		return util.ZipDir(f, toolchainDir, archiveTopDir)
+	}
+	return util.TarGzDir(f, toolchainDir, archiveTopDir)
+}
+
+// cachedToolchain returns the folder of the cached toolchain of a
+// version, without building the toolchain or syncing the repository.
+// Unresolved versions are resolved with the local repository (or the
+// cached toolchains), and source trees are hashed.
+func (gotv *GoTV) cachedToolchain(tv *toolchainVersion) (string, error) {
+	tv.forceSyncRepo = false
+	if err := tv.options.resolvePatches(); err != nil {
+		return "", err
+	}
+	if toolchainDir, ok := gotv.cachedTagToolchain(tv); ok {
+		return toolchainDir, nil
+	}
+
+	switch tv.kind {
+	case kind_Release, kind_Alias:
+		resolved, ok := gotv.resolveVersionLocally(*tv)
+		if !ok {
+			return "", fmt.Errorf("toolchain %s is not cached", tv)
+		}
+		*tv = resolved
+	case kind_Source:
+		if dir, hash := splitSourceVersion(tv.version); hash == "" {
+			info, err := hashSourceTree(dir)
+			if err != nil {
+				return "", err
+			}
+			tv.version = dir + "@" + info.Hash
+		}
+	}
+
+	// The info file is written after a build succeeds.
+	var toolchainDir = filepath.Join(gotv.cacheDir, tv.folderName())
+	if _, err := readToolchainInfo(toolchainDir); err != nil {
+		return "", fmt.Errorf("toolchain %s is not cached", tv)
+	}
+	if _, err := os.Stat(filepath.Join(toolchainDir, "bin", goCommandFilename(tv.options))); err != nil {
+		return "", fmt.Errorf("toolchain %s is not cached", tv)
+	}
+	return toolchainDir, nil
+}
+
+func (gotv *GoTV) exportVersion(args ...string) error {
+	var flags = newFlagSet("export-version")
+	var output = flags.String("o", "", "")
+	versions, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(versions) != 1 {
+		return errors.New(`export-version needs exact one version argument`)
+	}
+
+	var tv = parseGoToolchainVersion(versions[0], true)
+	if invalid, message := tv.IsInvalid(); invalid {
+		return errors.New(message)
+	}
+
+	toolchainDir, err := gotv.cachedToolchain(&tv)
+	if err != nil {
+		return err
+	}
+
+	// Toolchains cached by old gotv versions don't record versions.
+	info, err := readToolchainInfo(toolchainDir)
+	if err != nil {
+		return err
+	}
+	if info.Version == "" {
+		info.Version = tv.String()
+		if err := writeToolchainInfo(toolchainDir, info); err != nil {
+			return err
+		}
+	}
+
+	var archivePath = *output
+	if archivePath == "" {
+		archivePath = tv.folderName() + ".tar.gz"
+	}
+	if err := gotv.writeToolchainArchive(toolchainDir, archivePath); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(gotv.stdout, "Exported %s to %s.\n", tv, archivePath)
+	return nil
+}
+
+func (gotv *GoTV) importVersion(args ...string) (err error) {
+	var flags = newFlagSet("import-version")
+	var force = flags.Bool("force", false, "")
+	archives, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(archives) != 1 {
+		return errors.New(`import-version needs exact one archive argument`)
+	}
+	var archivePath = archives[0]
+
+	isZip, err := isZipArchive(archivePath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(gotv.cacheDir, 0700); err != nil {
+		return err
+	}
+	tempDir, err := os.MkdirTemp(gotv.cacheDir, "import-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	fmt.Fprintln(gotv.stdout, "[Run]: extract", gotv.replaceHomeDir(archivePath), "to", gotv.replaceHomeDir(tempDir))
+	if isZip {
+		err = util.ExtractZip(archivePath, tempDir)
+	} else {
+		var f *os.File
+		if f, err = os.Open(archivePath); err == nil {
+			err = util.ExtractTarGz(f, tempDir)
+			f.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	tv, extractedDir, err := validateExtractedToolchain(tempDir)
+	if err != nil {
+		return fmt.Errorf("invalid toolchain archive %s: %w", archivePath, err)
+	}
+
+	var toolchainDir = filepath.Join(gotv.cacheDir, tv.folderName())
+	if _, err := os.Stat(toolchainDir); err == nil {
+		if !*force {
+			return fmt.Errorf("version %s has been cached in %s (use -force to replace it)", tv, gotv.replaceHomeDir(toolchainDir))
+		}
+		fmt.Fprintln(gotv.stdout, "[Run]: rm -rf", gotv.replaceHomeDir(toolchainDir))
+		if err := os.RemoveAll(toolchainDir); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	fmt.Fprintln(gotv.stdout, "[Run]: mv", gotv.replaceHomeDir(extractedDir), gotv.replaceHomeDir(toolchainDir))
+	if err := os.Rename(extractedDir, toolchainDir); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(gotv.stdout, "Imported %s into %s.\n", tv, gotv.replaceHomeDir(toolchainDir))
+	return nil
+}
+
+// validateExtractedToolchain checks whether or not the single top
+// directory in dir is a toolchain exported by gotv.
+func validateExtractedToolchain(dir string) (tv toolchainVersion, toolchainDir string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		err = errors.New("a single top directory is expected")
+		return
+	}
+	toolchainDir = filepath.Join(dir, entries[0].Name())
+
+	info, err := readToolchainInfo(toolchainDir)
+	if err != nil {
+		err = fmt.Errorf("bad %s: %w", gotvInfoFile, err)
+		return
+	}
+	if info.Revision == "" || info.Version == "" {
+		err = fmt.Errorf("revision or version is missing in %s", gotvInfoFile)
+		return
+	}
+
+	tv = parseGoToolchainVersion(info.Version, true)
+	switch tv.kind {
+	case kind_Tag, kind_Branch, kind_Revision, kind_Source:
+	default:
+		err = fmt.Errorf("bad version in %s: %s", gotvInfoFile, info.Version)
+		return
+	}
+	tv.forceSyncRepo = false
+	if tv.options.patch != "" {
+		if !isPatchHash(info.PatchHash) {
+			err = fmt.Errorf("bad patch hash in %s: %q", gotvInfoFile, info.PatchHash)
+			return
+		}
+		// The patch files might not exist on this machine.
+		tv.options.patchHash = info.PatchHash
+	}
+	if tv.kind == kind_Source {
+		if _, hash := splitSourceVersion(tv.version); hash == "" {
+			err = fmt.Errorf("source version in %s is not hashed: %s", gotvInfoFile, info.Version)
+			return
+		}
+	}
+	// The folder name is used to build paths in the cache dir.
+	if !isSingleFolderName(tv.folderName()) {
+		err = fmt.Errorf("bad version in %s: %s", gotvInfoFile, info.Version)
+		return
+	}
+
+	if _, err = os.Stat(filepath.Join(toolchainDir, "bin", goCommandFilename(tv.options))); err != nil {
+		return
+	}
+	if _, err = os.Stat(filepath.Join(toolchainDir, "src", "runtime")); err != nil {
+		return
+	}
+
+	return
+}
+
+// isSingleFolderName reports whether or not name is a clean
+// path element, so that it never refers to outside folders.
+func isSingleFolderName(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!strings.ContainsAny(name, `/\:`) && filepath.Clean(name) == name
+}
@@ -0,0 +1,277 @@
+package toolchain
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"go101.org/gotv/internal/util"
+)
+
+// benchResults are the measurements of the benchmarks run by
+// a toolchain version, keyed by benchmark names then units.
+type benchResults map[string]map[string][]float64
+
+// parseBenchOutput collects the benchmark results in the output
+// of a go test -bench command. The names of the benchmarks are
+// prefixed with their packages (shown in the "pkg:" lines).
+func (results benchResults) parseBenchOutput(output []byte, names *[]string) {
+	var pkg string
+	var scanner = bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		var line = scanner.Text()
+		if strings.HasPrefix(line, "pkg: ") {
+			pkg = strings.TrimSpace(line[len("pkg: "):])
+			continue
+		}
+
+		var fields = strings.Fields(line)
+		if len(fields) < 4 || len(fields)%2 != 0 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+
+		var name = fields[0][len("Benchmark"):]
+		if pkg != "" {
+			name = pkg + "." + name
+		}
+		var units = results[name]
+		if units == nil {
+			units = make(map[string][]float64)
+			results[name] = units
+			*names = appendIfAbsent(*names, name)
+		}
+		for i := 2; i < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				break
+			}
+			units[fields[i+1]] = append(units[fields[i+1]], v)
+		}
+	}
+}
+
+func appendIfAbsent(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+// benchVersions runs the same benchmarks with two toolchain versions
+// several times and compares the results, such as
+//
+//	gotv bench -n=10 1.21 1.22 -- -bench=. ./...
+//
+// The runs of the two versions are interleaved, so that they are
+// equally affected by the changes of the system load.
+func (gotv *GoTV) benchVersions(args ...string) error {
+	var flags = newFlagSet("bench")
+	var runs = flags.Int("n", 5, "")
+	var alpha = flags.Float64("alpha", 0.05, "")
+	versions, tvs, opts, goArgs, err := parseVersionComparisonArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if *runs < 1 {
+		return errors.New(`the -n option of bench must be positive`)
+	}
+	if *alpha <= 0 || *alpha >= 1 {
+		return errors.New(`the -alpha option of bench must be in (0, 1)`)
+	}
+
+	var goOpts [2]goCommandOptions
+	for i := range tvs {
+		var specified = tvs[i]
+		if _, err := gotv.ensureToolchainVersion(&tvs[i], false); err != nil {
+			return err
+		}
+		if goOpts[i], err = gotv.completeGoCommandOptions(specified, tvs[i], opts); err != nil {
+			return err
+		}
+	}
+
+	var names []string
+	var results = [2]benchResults{make(benchResults), make(benchResults)}
+	var testArgs = append([]string{"test", "-run=^$", "-count=1"}, goArgs...)
+	for r := 1; r <= *runs; r++ {
+		for i := range tvs {
+			fmt.Fprintf(gotv.stdout, "(%d/%d) ", r, *runs)
+			var output bytes.Buffer
+			if err := gotv.runGoToolchainCommandWithIO(tvs[i], goOpts[i], testArgs, nil, &output, &output); err != nil {
+				gotv.stdout.Write(output.Bytes())
+				return err
+			}
+			results[i].parseBenchOutput(output.Bytes(), &names)
+		}
+	}
+	fmt.Fprintln(gotv.stdout)
+
+	if len(names) == 0 {
+		return errors.New("no benchmark results are found")
+	}
+	printBenchComparison(gotv.stdout, versions, results, names, *alpha)
+	return nil
+}
+
+// printBenchComparison prints a table for each unit, in the style
+// of the benchstat tool. The ± values are the maximum deviations
+// from the means. A delta is shown as ~ if the difference is not
+// significant (p-value of the Mann-Whitney U-test >= alpha).
+func printBenchComparison(out io.Writer, versions []string, results [2]benchResults, names []string, alpha float64) {
+	var units []string
+	for _, name := range names {
+		for i := range results {
+			for unit := range results[i][name] {
+				units = appendIfAbsent(units, unit)
+			}
+		}
+	}
+	sort.SliceStable(units, func(a, b int) bool {
+		return benchUnitOrder(units[a]) < benchUnitOrder(units[b])
+	})
+
+	var w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for k, unit := range units {
+		if k > 0 {
+			fmt.Fprintln(w)
+		}
+		var metric = benchMetricName(unit)
+		fmt.Fprintf(w, "name\t%s %s\t%s %s\tdelta\n", versions[0], metric, versions[1], metric)
+
+		var logSums [2]float64
+		var numMeans = 0
+		for _, name := range names {
+			var samples = [2][]float64{results[0][name][unit], results[1][name][unit]}
+			if len(samples[0]) == 0 && len(samples[1]) == 0 {
+				continue
+			}
+
+			var cells [2]string
+			var means [2]float64
+			for i := range samples {
+				if len(samples[i]) == 0 {
+					continue
+				}
+				var deviation float64
+				means[i], deviation = meanAndMaxDeviation(samples[i])
+				cells[i] = formatBenchValue(means[i], unit)
+				if means[i] != 0 {
+					cells[i] += fmt.Sprintf(" ± %2.0f%%", deviation/means[i]*100)
+				}
+			}
+
+			var delta = ""
+			if len(samples[0]) > 0 && len(samples[1]) > 0 {
+				var p = util.MannWhitneyUTest(samples[0], samples[1])
+				var stats = fmt.Sprintf("(p=%0.3f n=%d+%d)", p, len(samples[0]), len(samples[1]))
+				switch {
+				case p >= alpha:
+					delta = "~     " + stats
+				case means[0] == 0:
+					delta = "?     " + stats
+				default:
+					delta = fmt.Sprintf("%+.2f%%  %s", (means[1]/means[0]-1)*100, stats)
+				}
+				if means[0] > 0 && means[1] > 0 {
+					logSums[0] += math.Log(means[0])
+					logSums[1] += math.Log(means[1])
+					numMeans++
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, cells[0], cells[1], delta)
+		}
+
+		if numMeans > 1 {
+			var geomeans = [2]float64{math.Exp(logSums[0] / float64(numMeans)), math.Exp(logSums[1] / float64(numMeans))}
+			fmt.Fprintf(w, "[Geo mean]\t%s\t%s\t%+.2f%%\n", formatBenchValue(geomeans[0], unit), formatBenchValue(geomeans[1], unit), (geomeans[1]/geomeans[0]-1)*100)
+		}
+	}
+	w.Flush()
+}
+
+func meanAndMaxDeviation(samples []float64) (mean, deviation float64) {
+	for _, v := range samples {
+		mean += v
+	}
+	mean /= float64(len(samples))
+	for _, v := range samples {
+		if d := math.Abs(v - mean); d > deviation {
+			deviation = d
+		}
+	}
+	return
+}
+
+func benchUnitOrder(unit string) int {
+	switch unit {
+	case "ns/op":
+		return 0
+	case "MB/s":
+		return 1
+	case "B/op":
+		return 2
+	case "allocs/op":
+		return 3
+	}
+	return 4
+}
+
+func benchMetricName(unit string) string {
+	switch unit {
+	case "ns/op":
+		return "time/op"
+	case "MB/s":
+		return "speed"
+	case "B/op":
+		return "alloc/op"
+	case "allocs/op":
+		return "allocs/op"
+	}
+	return unit
+}
+
+func formatBenchValue(v float64, unit string) string {
+	var scaled = func(v float64, units []string, base float64) string {
+		var i = 0
+		for ; i < len(units)-1 && math.Abs(v) >= base; i++ {
+			v /= base
+		}
+		return strconv.FormatFloat(v, 'f', significantDecimals(v), 64) + units[i]
+	}
+
+	switch unit {
+	case "ns/op":
+		return scaled(v, []string{"ns", "µs", "ms", "s"}, 1000)
+	case "B/op":
+		return scaled(v, []string{"B", "kB", "MB", "GB"}, 1000)
+	case "MB/s":
+		return strconv.FormatFloat(v, 'f', significantDecimals(v), 64) + "MB/s"
+	}
+	return strconv.FormatFloat(v, 'f', significantDecimals(v), 64)
+}
+
+// significantDecimals returns the number of decimals
+// to show v with (at least) 3 significant digits.
+func significantDecimals(v float64) int {
+	switch v = math.Abs(v); {
+	case v == 0 || v >= 100:
+		return 0
+	case v >= 10:
+		return 1
+	case v >= 1:
+		return 2
+	}
+	return 3
+}
@@ -0,0 +1,140 @@
+package toolchain
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go101.org/gotv/internal/util"
+)
+
+// diffVersions runs the same go command with two toolchain versions
+// and shows the differences between the outputs, such as
+//
+//	gotv diff 1.20 1.21 -- build -gcflags=-m ./pkg
+//
+// The GOROOT and home directories in the outputs are normalized,
+// so that only the real behavior changes are shown.
+func (gotv *GoTV) diffVersions(args ...string) error {
+	var flags = newFlagSet("diff")
+	var context = flags.Int("U", 3, "")
+	versions, tvs, opts, goArgs, err := parseVersionComparisonArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if *context < 0 {
+		return errors.New(`the -U option of diff must not be negative`)
+	}
+
+	var outputs [2]string
+	var names [2]string
+	for i := range tvs {
+		var tv = tvs[i]
+		toolchainDir, err := gotv.ensureToolchainVersion(&tv, false)
+		if err != nil {
+			return err
+		}
+		names[i] = versions[i]
+		if normalized := tv.String(); normalized != versions[i] {
+			names[i] += " (" + normalized + ")"
+		}
+
+		o, err := gotv.completeGoCommandOptions(tvs[i], tv, opts)
+		if err != nil {
+			return err
+		}
+		var output bytes.Buffer
+		err = gotv.runGoToolchainCommandWithIO(tv, o, goArgs, nil, &output, &output)
+		if err != nil {
+			var ee *exec.ExitError
+			if !errors.As(err, &ee) {
+				return err
+			}
+			fmt.Fprintf(&output, "[%s]\n", ee)
+		}
+		outputs[i] = gotv.normalizeOutput(output.String(), toolchainDir)
+	}
+	fmt.Fprintln(gotv.stdout)
+
+	changed, err := util.UnifiedDiff(gotv.stdout, names[0], names[1], outputs[0], outputs[1], *context)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		fmt.Fprintln(gotv.stdout, "No differences.")
+	}
+	return nil
+}
+
+// parseVersionComparisonArgs parses the arguments of the commands
+// which compare two versions, in the form of
+//
+//	[options] Version1 Version2 [-env:NAME=VALUE ...] -- go-arguments...
+func parseVersionComparisonArgs(flags *flag.FlagSet, args []string) (versions []string, tvs []toolchainVersion, opts goCommandOptions, goArgs []string, err error) {
+	for i, arg := range args {
+		if arg == "--" {
+			args, goArgs = args[:i], args[i+1:]
+			break
+		}
+	}
+	if goArgs == nil {
+		err = fmt.Errorf("%s needs go arguments after --", flags.Name())
+		return
+	}
+
+	var flagArgs = make([]string, 0, len(args))
+	for _, arg := range args {
+		if !isGoCommandOption(arg) {
+			flagArgs = append(flagArgs, arg)
+			continue
+		}
+
+		var o goCommandOptions
+		if o, _, err = parseGoCommandOptions([]string{arg}); err != nil {
+			return
+		}
+		opts.envs = append(opts.envs, o.envs...)
+		if o.gocache != "" {
+			opts.gocache = o.gocache
+		}
+		if o.gomodcache != "" {
+			opts.gomodcache = o.gomodcache
+		}
+	}
+
+	if versions, err = parseFlags(flags, flagArgs); err != nil {
+		return
+	}
+	if len(versions) != 2 {
+		err = fmt.Errorf("%s needs exact two versions", flags.Name())
+		return
+	}
+
+	if tvs, err = parseGoToolchainVersions(versions...); err != nil {
+		return
+	}
+	for i := range tvs {
+		if tvs[i].options.isCrossCompiled() {
+			err = fmt.Errorf("toolchain %s is built for %s, it can't run on this host", tvs[i], tvs[i].options.target())
+			return
+		}
+	}
+	return
+}
+
+// normalizeOutput replaces the GOROOT and home directories
+// in the output of a go command with $GOROOT and $HOME.
+func (gotv *GoTV) normalizeOutput(output, toolchainDir string) string {
+	output = strings.Replace(output, toolchainDir, "$GOROOT", -1)
+	if slashed := filepath.ToSlash(toolchainDir); slashed != toolchainDir {
+		output = strings.Replace(output, slashed, "$GOROOT", -1)
+	}
+	if gotv.homeDir != "" {
+		output = strings.Replace(output, gotv.homeDir, "$HOME", -1)
+	}
+	return output
+}
@@ -0,0 +1,153 @@
+package toolchain
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go101.org/gotv/internal/util"
+)
+
+// A versionJob records the result of processing a version
+// in a multi-version command, such as cache-version.
+type versionJob struct {
+	specified string // the version as specified in command line
+	tv        toolchainVersion
+
+	started  bool
+	err      error
+	duration time.Duration
+}
+
+func newVersionJobs(versions []string, tvs []toolchainVersion) []versionJob {
+	var jobs = make([]versionJob, len(tvs))
+	for i := range jobs {
+		jobs[i].specified = versions[i]
+		jobs[i].tv = tvs[i]
+	}
+	return jobs
+}
+
+type versionJobFunc func(gotv *GoTV, tv *toolchainVersion) error
+
+// runVersionJobs calls do for the jobs, with at most parallel calls
+// running concurrently. Unless keepGoing is true, no new calls start
+// after a call fails.
+//
+// When parallel > 1, each call is passed a gotv copy whose outputs
+// (and terminal progress) are prefixed with the version of the job.
+func (gotv *GoTV) runVersionJobs(jobs []versionJob, parallel int, keepGoing bool, do versionJobFunc) {
+	var width = 0
+	for i := range jobs {
+		if n := len(jobs[i].specified); n > width {
+			width = n
+		}
+	}
+
+	var outputMutex sync.Mutex
+	var run = func(job *versionJob) {
+		var g = gotv
+		if parallel > 1 {
+			var prefix = fmt.Sprintf("[%-*s] ", width, job.specified)
+			var stdout = util.NewPrefixWriter(gotv.stdout, &outputMutex, prefix)
+			var stderr = util.NewPrefixWriter(gotv.stderr, &outputMutex, prefix)
+			defer stdout.Flush()
+			defer stderr.Flush()
+
+			var fork = *gotv
+			fork.stdout, fork.stderr = stdout, stderr
+			if _, ok := gotv.reporter.(*terminalReporter); ok {
+				fork.reporter = NewTerminalReporter(stdout)
+			}
+			fork.versionGoCmdPaths = make(map[toolchainVersion]string)
+			g = &fork
+		}
+
+		defer func() {
+			if job.err != nil {
+				fmt.Fprintln(g.stderr, job.err)
+			}
+		}()
+
+		var start = time.Now()
+		job.started = true
+		job.err = do(g, &job.tv)
+		job.duration = time.Since(start)
+	}
+
+	if parallel <= 1 {
+		for i := range jobs {
+			if run(&jobs[i]); jobs[i].err != nil && !keepGoing {
+				break
+			}
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed bool
+	var tokens = make(chan struct{}, parallel)
+	for i := range jobs {
+		tokens <- struct{}{}
+		mu.Lock()
+		var stop = failed
+		mu.Unlock()
+		if stop {
+			break
+		}
+
+		wg.Add(1)
+		go func(job *versionJob) {
+			defer wg.Done()
+			if run(job); job.err != nil && !keepGoing {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+			<-tokens
+		}(&jobs[i])
+	}
+	wg.Wait()
+}
+
+// printVersionJobsSummary prints a summary table of the jobs,
+// and returns an error if any job failed or didn't start.
+func (gotv *GoTV) printVersionJobsSummary(jobs []versionJob, doneStatus string) error {
+	var width = 0
+	for i := range jobs {
+		if n := len(jobs[i].specified); n > width {
+			width = n
+		}
+	}
+
+	var failed, skipped int
+	fmt.Fprintln(gotv.stdout)
+	fmt.Fprintln(gotv.stdout, "Summary:")
+	for i := range jobs {
+		var job = &jobs[i]
+		switch {
+		case !job.started:
+			skipped++
+			fmt.Fprintf(gotv.stdout, "\t%-*s  %s\n", width, job.specified, "skipped")
+		case job.err != nil:
+			failed++
+			var message = job.err.Error()
+			if k := strings.IndexByte(message, '\n'); k >= 0 {
+				message = message[:k]
+			}
+			fmt.Fprintf(gotv.stdout, "\t%-*s  %-8s  %-8s  %s\n", width, job.specified, "failed", job.duration.Round(time.Second), message)
+		default:
+			fmt.Fprintf(gotv.stdout, "\t%-*s  %-8s  %s\n", width, job.specified, doneStatus, job.duration.Round(time.Second))
+		}
+	}
+
+	if failed == 0 && skipped == 0 {
+		return nil
+	}
+	if skipped == 0 {
+		return fmt.Errorf("%d of %d versions failed", failed, len(jobs))
+	}
+	return fmt.Errorf("%d of %d versions failed, %d skipped", failed, len(jobs), skipped)
+}